@@ -0,0 +1,105 @@
+package gotoon
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type benchmarkRow struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Active    bool      `json:"active"`
+	Score     float64   `json:"score"`
+	Role      string    `json:"role,omitempty"`
+	Team      string    `toon:"team,header=t"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func benchmarkRows(n int) []benchmarkRow {
+	rows := make([]benchmarkRow, n)
+	created := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	for i := range rows {
+		rows[i] = benchmarkRow{
+			ID:        int64(i),
+			Name:      fmt.Sprintf("User %d", i),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+			Active:    i%2 == 0,
+			Score:     float64(i) * 1.5,
+			Role:      "member",
+			Team:      "core",
+			CreatedAt: created.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return rows
+}
+
+func BenchmarkEncodeStructs(b *testing.B) {
+	rows := benchmarkRows(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Encode(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeMaps(b *testing.B) {
+	rows := make([]map[string]interface{}, 1000)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": i, "name": fmt.Sprintf("User %d", i), "active": i%2 == 0}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Encode(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStructs(b *testing.B) {
+	encoded, err := Encode(benchmarkRows(1000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := []byte(encoded)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var rows []benchmarkRow
+		if err := Unmarshal(data, &rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNormalizeStructs(b *testing.B) {
+	rows := benchmarkRows(1000)
+	opts := defaultOptions()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := normalizeValue(rows, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTypeFields(b *testing.B) {
+	t := reflect.TypeOf(benchmarkRow{})
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			typeFields(t)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cachedTypeFields(t)
+		}
+	})
+}
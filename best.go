@@ -0,0 +1,91 @@
+package gotoon
+
+import "bytes"
+
+// EncodingFormat identifies a representation produced by EncodeBest
+type EncodingFormat int
+
+const (
+	// FormatTOON is TOON encoded with the options given to EncodeBest
+	FormatTOON EncodingFormat = iota
+
+	// FormatTOONExtended is TOON encoded with sparse and nested tabular
+	// arrays and key folding on top of the given options. Decode it with
+	// WithPathExpansion to restore nested objects.
+	FormatTOONExtended
+
+	// FormatJSON is compact JSON of the same data as the TOON candidates,
+	// written like ToJSON writes it
+	FormatJSON
+)
+
+// String returns the name of the format
+func (f EncodingFormat) String() string {
+	switch f {
+	case FormatTOON:
+		return "toon"
+	case FormatTOONExtended:
+		return "toon-extended"
+	case FormatJSON:
+		return "json"
+	}
+	return "unknown"
+}
+
+// BestEncoding is the cheapest representation found by EncodeBest
+type BestEncoding struct {
+	// Format is the representation that was chosen
+	Format EncodingFormat
+
+	// Output is the encoded value
+	Output string
+
+	// Tokens is the token count of Output
+	Tokens int
+}
+
+// EncodeBest encodes v as TOON, as TOON with the opt-in tabular extensions
+// and key folding, and as compact JSON, and returns whichever needs the
+// fewest tokens. Tokens are counted with the tokenizer set by WithTokenizer,
+// or DefaultTokenizer; WithTokenizer(CharTokenizer{}) measures with a cheaper
+// character count instead. Ties go to plain TOON, then extended TOON.
+//
+// All three are built from the same normalized value, so toon struct tags,
+// marshalers and the truncation limits of the options apply to the JSON
+// candidate as well; its arrays are truncated like those of plain TOON.
+// Errors are returned as from EncodeWithResult.
+//
+// Example:
+//
+//	best, err := gotoon.EncodeBest(results)
+//	prompt := "Results (" + best.Format.String() + "):\n" + best.Output
+func EncodeBest(v interface{}, opts ...EncodeOption) (*BestEncoding, error) {
+	options := resolveOptions(opts)
+	normalized, err := normalizeValue(v, options)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := truncateTree(normalized, options)
+	if err != nil {
+		return nil, err
+	}
+	best := &BestEncoding{Format: FormatTOON, Output: plain.Output, Tokens: plain.Tokens}
+
+	extendedOpts := append(opts[:len(opts):len(opts)],
+		WithSparseTabular(SparseEmpty), WithNestedTabular(), WithKeyFolding())
+	extended, err := truncateTree(normalized, resolveOptions(extendedOpts))
+	if err != nil {
+		return nil, err
+	}
+	if extended.Output != plain.Output && extended.Tokens < best.Tokens {
+		best = &BestEncoding{Format: FormatTOONExtended, Output: extended.Output, Tokens: extended.Tokens}
+	}
+
+	var compact bytes.Buffer
+	writeJSON(&compact, plain.tree)
+	if tokens := options.tokenizer().CountTokens(compact.String()); tokens < best.Tokens {
+		best = &BestEncoding{Format: FormatJSON, Output: compact.String(), Tokens: tokens}
+	}
+	return best, nil
+}
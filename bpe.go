@@ -0,0 +1,227 @@
+package gotoon
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// cl100kBaseVocab is OpenAI's cl100k_base.tiktoken vocabulary (SHA-256
+// 223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7 before
+// compression), compressed with gzip -9 -n
+//
+//go:embed vocab/cl100k_base.tiktoken.gz
+var cl100kBaseVocab []byte
+
+// cl100kBase loads the embedded vocabulary once, on first use
+var cl100kBase = sync.OnceValue(func() *BPETokenizer {
+	r, err := gzip.NewReader(bytes.NewReader(cl100kBaseVocab))
+	if err != nil {
+		panic("toon: embedded cl100k_base vocabulary: " + err.Error())
+	}
+	tokenizer, err := NewBPETokenizer(r)
+	if err != nil {
+		panic("toon: embedded cl100k_base vocabulary: " + err.Error())
+	}
+	return tokenizer
+})
+
+// CL100KBase returns a BPETokenizer with the cl100k_base vocabulary of
+// GPT-4 and GPT-3.5, which is embedded in the module. Its counts match
+// tiktoken's for text without special tokens. The vocabulary is loaded on
+// the first call and shared by all callers.
+func CL100KBase() *BPETokenizer {
+	return cl100kBase()
+}
+
+// BPETokenizer counts tokens with byte-level byte pair encoding, the scheme
+// used by OpenAI's cl100k_base and o200k_base encodings. Text is split into
+// pieces with the cl100k pre-tokenization rules and each piece is merged
+// according to the ranks of the loaded vocabulary.
+type BPETokenizer struct {
+	ranks map[string]int
+}
+
+// NewBPETokenizer loads a vocabulary in the tiktoken format used by files
+// such as cl100k_base.tiktoken: one token per line, base64 encoded and
+// followed by its merge rank. CL100KBase returns one for the embedded
+// cl100k_base vocabulary.
+func NewBPETokenizer(r io.Reader) (*BPETokenizer, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		encoded, rankText, ok := strings.Cut(text, Space)
+		if !ok {
+			return nil, fmt.Errorf("toon: vocabulary line %d: missing rank", lineNum)
+		}
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("toon: vocabulary line %d: %w", lineNum, err)
+		}
+		rank, err := strconv.Atoi(rankText)
+		if err != nil {
+			return nil, fmt.Errorf("toon: vocabulary line %d: invalid rank %q", lineNum, rankText)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &BPETokenizer{ranks: ranks}, nil
+}
+
+// CountTokens returns the number of tokens s encodes to
+func (t *BPETokenizer) CountTokens(s string) int {
+	count := 0
+	for _, piece := range splitPieces(s) {
+		count += t.countPiece(piece)
+	}
+	return count
+}
+
+// countPiece returns the number of tokens a single piece merges into
+func (t *BPETokenizer) countPiece(piece string) int {
+	if _, ok := t.ranks[piece]; ok {
+		return 1
+	}
+
+	// Start from single bytes and repeatedly merge the adjacent pair with
+	// the lowest rank until no pair is in the vocabulary
+	parts := make([]string, len(piece))
+	for i := range parts {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(parts); i++ {
+			rank, ok := t.ranks[parts[i]+parts[i+1]]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts)
+}
+
+// splitPieces splits text into the pieces that are merged independently,
+// following the cl100k_base pre-tokenization pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// The pattern needs a lookahead, which the regexp package does not support,
+// so the alternatives are matched by hand in the same order.
+func splitPieces(s string) []string {
+	var pieces []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		n := matchPiece(runes, i)
+		pieces = append(pieces, string(runes[i:i+n]))
+		i += n
+	}
+	return pieces
+}
+
+// matchPiece returns the length in runes of the piece starting at i
+func matchPiece(runes []rune, i int) int {
+	at := func(j int) rune {
+		if j < len(runes) {
+			return runes[j]
+		}
+		return -1
+	}
+	isNewline := func(r rune) bool { return r == '\r' || r == '\n' }
+	isOther := func(r rune) bool {
+		return r >= 0 && !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}
+	r := runes[i]
+
+	// Contractions
+	if r == '\'' {
+		next := unicode.ToLower(at(i + 1))
+		switch next {
+		case 's', 't', 'm', 'd':
+			return 2
+		}
+		pair := string([]rune{next, unicode.ToLower(at(i + 2))})
+		if pair == "re" || pair == "ve" || pair == "ll" {
+			return 3
+		}
+	}
+
+	// Words, with an optional leading character that is not a letter,
+	// digit or newline
+	start := i
+	if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !isNewline(r) && unicode.IsLetter(at(i+1)) {
+		start++
+	}
+	if unicode.IsLetter(at(start)) {
+		j := start
+		for j < len(runes) && unicode.IsLetter(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+
+	// Up to three digits
+	if unicode.IsNumber(r) {
+		j := i
+		for j < len(runes) && j-i < 3 && unicode.IsNumber(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+
+	// Punctuation with an optional leading space and trailing newlines
+	j := i
+	if r == ' ' && isOther(at(i+1)) {
+		j++
+	}
+	if isOther(at(j)) {
+		for j < len(runes) && isOther(runes[j]) {
+			j++
+		}
+		for j < len(runes) && isNewline(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+
+	// Whitespace runs, ending at their last newline if they have one, or
+	// leaving their last character to the following piece
+	end := i
+	lastNewline := -1
+	for end < len(runes) && unicode.IsSpace(runes[end]) {
+		if isNewline(runes[end]) {
+			lastNewline = end
+		}
+		end++
+	}
+	if lastNewline >= 0 {
+		return lastNewline + 1 - i
+	}
+	if end == len(runes) || end-i == 1 {
+		return end - i
+	}
+	return end - 1 - i
+}
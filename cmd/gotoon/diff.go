@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// maxDiffSteps bounds the search for the shortest edit script, keeping the
+// time spent on large rewrites such as a changed indentation linear
+const maxDiffSteps = 1000
+
+// lineEdit is one step of a line diff
+type lineEdit struct {
+	op   byte // ' ' to keep, '-' to delete or '+' to insert
+	text string
+}
+
+// unifiedDiff returns the differences between two texts in unified diff
+// format, or an empty string when they are equal
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	edits := diffLines(splitTextLines(oldText), splitTextLines(newText))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Group changes whose context overlaps into hunks
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		first := max(start-diffContext, 0)
+		end, kept := start, 0
+		for end < len(edits) && kept <= 2*diffContext {
+			if edits[end].op == ' ' {
+				kept++
+			} else {
+				kept = 0
+			}
+			end++
+		}
+		// Keep at most diffContext unchanged lines after the last change
+		last := min(end-kept+diffContext, len(edits))
+
+		oldStart, newStart := 1, 1
+		for _, e := range edits[:first] {
+			if e.op != '+' {
+				oldStart++
+			}
+			if e.op != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, e := range edits[first:last] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, e := range edits[first:last] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.text)
+			sb.WriteByte('\n')
+		}
+		start = last
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start and length of a hunk side
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range refers to the line before it
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitTextLines splits text into lines without their line endings
+func splitTextLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the shortest edit script turning a into b, found with
+// the linear space variant of Myers' algorithm. Parts that differ by more
+// than about 2*maxDiffSteps lines are replaced as a whole instead.
+func diffLines(a, b []string) []lineEdit {
+	size := min(len(a)+len(b), maxDiffSteps) + 1
+	d := &lineDiffer{
+		a:        a,
+		b:        b,
+		offset:   size,
+		forward:  make([]int, 2*size+1),
+		backward: make([]int, 2*size+1),
+	}
+	d.diff(0, len(a), 0, len(b))
+	return d.edits
+}
+
+// lineDiffer holds the state of diffLines. The furthest reaching paths are
+// kept for one search at a time, so memory grows with the length of the
+// texts rather than with the number of differences.
+type lineDiffer struct {
+	a, b   []string
+	edits  []lineEdit
+	offset int
+
+	// forward and backward hold, per diagonal, how far the paths from the
+	// start and from the end of the texts reach
+	forward, backward []int
+}
+
+// diff appends the edits turning a[a0:a1] into b[b0:b1]
+func (d *lineDiffer) diff(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.edits = append(d.edits, lineEdit{' ', d.a[a0]})
+		a0++
+		b0++
+	}
+	end := a1
+	for a1 > a0 && b1 > b0 && d.a[a1-1] == d.b[b1-1] {
+		a1--
+		b1--
+	}
+
+	if x, y, ok := d.split(a0, a1, b0, b1); ok {
+		// Both halves hold at least one edit, since a single edit leaves
+		// one side empty once common lines are removed
+		d.diff(a0, x, b0, y)
+		d.diff(x, a1, y, b1)
+	} else {
+		// Replace the lines as a whole when either side is empty or the
+		// search gives up
+		for _, line := range d.a[a0:a1] {
+			d.edits = append(d.edits, lineEdit{'-', line})
+		}
+		for _, line := range d.b[b0:b1] {
+			d.edits = append(d.edits, lineEdit{'+', line})
+		}
+	}
+
+	for _, line := range d.a[a1:end] {
+		d.edits = append(d.edits, lineEdit{' ', line})
+	}
+}
+
+// split returns a point on a shortest edit path from (a0, b0) to (a1, b1),
+// found by searching from both ends until the paths overlap. It gives up
+// when a side is empty or after maxDiffSteps steps from each end.
+func (d *lineDiffer) split(a0, a1, b0, b1 int) (int, int, bool) {
+	n, m := a1-a0, b1-b0
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	delta := n - m
+	d.forward[d.offset+1], d.backward[d.offset+1] = 0, 0
+
+	for steps := 0; steps <= maxDiffSteps; steps++ {
+		// Extend the paths from the start, where diagonal k holds the
+		// points with x - y = k
+		for k := -steps; k <= steps; k += 2 {
+			x := d.next(d.forward, k, steps)
+			y := x - k
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			d.forward[d.offset+k] = x
+			if c := delta - k; delta%2 != 0 && -steps < c && c < steps && x+d.backward[d.offset+c] >= n {
+				return a0 + x, b0 + y, true
+			}
+		}
+
+		// Extend the paths from the end, measured back from (n, m)
+		for c := -steps; c <= steps; c += 2 {
+			x := d.next(d.backward, c, steps)
+			y := x - c
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x++
+				y++
+			}
+			d.backward[d.offset+c] = x
+			if k := delta - c; delta%2 == 0 && -steps <= k && k <= steps && x+d.forward[d.offset+k] >= n {
+				return a1 - x, b1 - y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// next returns where a path on diagonal k starts after one more step: from
+// the neighbouring diagonal that reached furthest
+func (d *lineDiffer) next(v []int, k, steps int) int {
+	if k == -steps || (k != steps && v[d.offset+k-1] < v[d.offset+k+1]) {
+		return v[d.offset+k+1]
+	}
+	return v[d.offset+k-1] + 1
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k8scat/gotoon"
+)
+
+// formatter holds the flags of the fmt command
+type formatter struct {
+	write bool
+	diff  bool
+	list  bool
+
+	encodeFlags
+	opts []gotoon.EncodeOption
+}
+
+// formatCommand runs the fmt command, which rewrites TOON documents in
+// canonical form
+func formatCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	f := &formatter{}
+	flags := flag.NewFlagSet("gotoon fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gotoon fmt [flags] [path ...]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Rewrites TOON documents in canonical form. Directories are searched for .toon files.")
+		fmt.Fprintln(stderr, "Reads standard input when no path is given.")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.BoolVar(&f.write, "w", false, "write the result to the file instead of standard output")
+	flags.BoolVar(&f.diff, "d", false, "display diffs instead of rewriting files")
+	flags.BoolVar(&f.list, "l", false, "list files whose formatting differs")
+	f.encodeFlags.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	opts, err := f.encodeFlags.options()
+	if err != nil {
+		return usageError(flags, err.Error())
+	}
+	f.opts = opts
+
+	if flags.NArg() == 0 {
+		if f.write {
+			return usageError(flags, "cannot use -w with standard input")
+		}
+		return f.formatFile("<standard input>", stdin, stdout)
+	}
+
+	// Report every file that fails to format, then fail as a whole
+	failed := false
+	for _, path := range flags.Args() {
+		err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (name != path && !isTOONFile(name)) {
+				return nil
+			}
+			file, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if err := f.formatFile(name, file, stdout); err != nil {
+				fmt.Fprintf(stderr, "gotoon: %s: %v\n", name, err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "gotoon: %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// formatFile formats one document, writing it to stdout, back to the file,
+// or as a diff or file name, as selected by the flags
+func (f *formatter) formatFile(name string, r io.Reader, stdout io.Writer) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	formatted, err := gotoon.Format(src, f.opts...)
+	if err != nil {
+		return err
+	}
+
+	changed := !bytes.Equal(src, formatted)
+	if f.list && changed {
+		fmt.Fprintln(stdout, name)
+	}
+	if f.diff && changed {
+		io.WriteString(stdout, unifiedDiff(name+".orig", name, string(src), string(formatted)))
+	}
+	if f.write && changed {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, formatted, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if !f.list && !f.diff && !f.write {
+		_, err := stdout.Write(formatted)
+		return err
+	}
+	return nil
+}
+
+// isTOONFile reports whether a file name has the .toon extension
+func isTOONFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".toon")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatCommand(t *testing.T) {
+	const (
+		messy     = "name:   \"Alice\"\nitems[#2|]{id|name}:\n    1|A\n    2|B\n"
+		canonical = "name: Alice\nitems[2]{id,name}:\n  1,A\n  2,B\n"
+	)
+
+	t.Run("stdin", func(t *testing.T) {
+		code, stdout, stderr := runCommand(t, messy, "fmt")
+		if code != 0 {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		if stdout != canonical {
+			t.Errorf("expected:\n%s\ngot:\n%s", canonical, stdout)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		_, stdout, _ := runCommand(t, messy, "fmt", "-indent", "4", "-delimiter", "tab", "-length-marker")
+		expected := "name: Alice\nitems[#2\t]{id\tname}:\n    1\tA\n    2\tB\n"
+		if stdout != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, stdout)
+		}
+	})
+
+	t.Run("tabular extensions", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			args     []string
+			expected string
+		}{
+			{"rows[2]{a,b}:\n  1,2\n  3,\n", []string{"-sparse", "empty"}, "rows[2]{a,b}:\n  1,2\n  3,\n"},
+			{"rows[2]{a,b}:\n  1,2\n  3,\n", nil, "rows[2]:\n  - a: 1\n    b: 2\n  - a: 3\n"},
+			{"rows[2]{id,tags}:\n  1,[x,y]\n  2,[z]\n", []string{"-nested-tabular"}, "rows[2]{id,tags}:\n  1,[x,y]\n  2,[z]\n"},
+		}
+		for _, tt := range tests {
+			code, stdout, stderr := runCommand(t, tt.input, append([]string{"fmt"}, tt.args...)...)
+			if code != 0 {
+				t.Fatalf("%v: exit code %d: %s", tt.args, code, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("%v: expected:\n%s\ngot:\n%s", tt.args, tt.expected, stdout)
+			}
+		}
+
+		if code, _, stderr := runCommand(t, "", "fmt", "-sparse", "maybe"); code != 2 || !strings.Contains(stderr, "invalid sparse mode") {
+			t.Errorf("expected a usage error for -sparse maybe, got exit code %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("write and list", func(t *testing.T) {
+		dir := t.TempDir()
+		messyFile := filepath.Join(dir, "messy.toon")
+		cleanFile := filepath.Join(dir, "sub", "clean.toon")
+		otherFile := filepath.Join(dir, "notes.txt")
+		writeFile(t, messyFile, messy)
+		writeFile(t, cleanFile, canonical)
+		writeFile(t, otherFile, messy)
+
+		code, stdout, stderr := runCommand(t, "", "fmt", "-l", dir)
+		if code != 0 {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		if stdout != messyFile+"\n" {
+			t.Errorf("expected only %s to be listed, got:\n%s", messyFile, stdout)
+		}
+
+		if code, stdout, stderr := runCommand(t, "", "fmt", "-w", dir); code != 0 || stdout != "" {
+			t.Fatalf("exit code %d: %s%s", code, stdout, stderr)
+		}
+		if content := readFile(t, messyFile); content != canonical {
+			t.Errorf("expected the file to be rewritten, got:\n%s", content)
+		}
+		if content := readFile(t, otherFile); content != messy {
+			t.Errorf("expected other files to be left alone, got:\n%s", content)
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "data.toon")
+		writeFile(t, name, messy)
+
+		code, stdout, stderr := runCommand(t, "", "fmt", "-d", name)
+		if code != 0 {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		expected := "--- " + name + ".orig\n+++ " + name + "\n" +
+			"@@ -1,4 +1,4 @@\n" +
+			"-name:   \"Alice\"\n-items[#2|]{id|name}:\n-    1|A\n-    2|B\n" +
+			"+name: Alice\n+items[2]{id,name}:\n+  1,A\n+  2,B\n"
+		if stdout != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, stdout)
+		}
+		if content := readFile(t, name); content != messy {
+			t.Errorf("expected -d to leave the file alone, got:\n%s", content)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		dir := t.TempDir()
+		bad := filepath.Join(dir, "bad.toon")
+		good := filepath.Join(dir, "good.toon")
+		writeFile(t, bad, "items[3]: a,b\n")
+		writeFile(t, good, messy)
+
+		code, stdout, stderr := runCommand(t, "", "fmt", bad, good)
+		if code != 1 {
+			t.Errorf("expected exit code 1, got %d", code)
+		}
+		if !strings.Contains(stderr, bad+": ") || stdout != canonical {
+			t.Errorf("expected the error to be reported and the other file formatted, got:\n%s%s", stdout, stderr)
+		}
+
+		if code, _, stderr := runCommand(t, messy, "fmt", "-w"); code != 2 || !strings.Contains(stderr, "standard input") {
+			t.Errorf("expected a usage error for -w on stdin, got exit code %d: %s", code, stderr)
+		}
+		if code, _, _ := runCommand(t, "", "fmt", filepath.Join(dir, "missing.toon")); code != 1 {
+			t.Errorf("expected exit code 1 for a missing file, got %d", code)
+		}
+	})
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int, change map[int]string) string {
+		var sb strings.Builder
+		for i := 1; i <= n; i++ {
+			if text, ok := change[i]; ok {
+				if text != "" {
+					sb.WriteString(text + "\n")
+				}
+				continue
+			}
+			sb.WriteString("line" + string(rune('a'+i-1)) + "\n")
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{
+			name:     "equal",
+			old:      "a\n",
+			new:      "a\n",
+			expected: "",
+		},
+		{
+			name: "separate hunks",
+			old:  lines(20, nil),
+			new:  lines(20, map[int]string{2: "changed", 18: ""}),
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n linea\n-lineb\n+changed\n linec\n lined\n linee\n" +
+				"@@ -15,6 +15,5 @@\n lineo\n linep\n lineq\n-liner\n lines\n linet\n",
+		},
+		{
+			name: "merged hunks",
+			old:  lines(10, nil),
+			new:  lines(10, map[int]string{2: "x", 8: "y"}),
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,10 +1,10 @@\n linea\n-lineb\n+x\n linec\n lined\n linee\n linef\n lineg\n-lineh\n+y\n linei\n linej\n",
+		},
+		{
+			name:     "from empty",
+			old:      "",
+			new:      "a\nb\n",
+			expected: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := unifiedDiff("old", "new", tt.old, tt.new); diff != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, diff)
+			}
+		})
+	}
+
+	t.Run("large reindent", func(t *testing.T) {
+		var old, new strings.Builder
+		for i := range 20000 {
+			fmt.Fprintf(&old, "  key%d: %d\n", i, i)
+			fmt.Fprintf(&new, "    key%d: %d\n", i, i)
+			if i%100 == 0 {
+				old.WriteString("---\n")
+				new.WriteString("---\n")
+			}
+		}
+		diff := unifiedDiff("old", "new", old.String(), new.String())
+		if !strings.HasPrefix(diff, "--- old\n+++ new\n@@ -1,20200 +1,20200 @@\n-  key0: 0\n") {
+			t.Errorf("unexpected diff start:\n%.200s", diff)
+		}
+		if strings.Count(diff, "\n-  key") != 20000 || strings.Count(diff, "\n+    key") != 20000 {
+			t.Error("expected every key line to change")
+		}
+	})
+
+	t.Run("large file with few changes", func(t *testing.T) {
+		var old, new strings.Builder
+		for i := range 20000 {
+			fmt.Fprintf(&old, "key%d: %d\n", i, i)
+			if i != 5000 && i != 15000 {
+				fmt.Fprintf(&new, "key%d: %d\n", i, i)
+			}
+		}
+		diff := unifiedDiff("old", "new", old.String(), new.String())
+		if strings.Count(diff, "@@ -") != 2 || strings.Count(diff, "\n-") != 2 || strings.Count(diff, "\n+") != 1 {
+			t.Errorf("expected two hunks deleting one line each, got:\n%s", diff)
+		}
+	})
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -0,0 +1,243 @@
+// Command gotoon converts between JSON and TOON.
+//
+// Usage:
+//
+//	gotoon [flags] [file]
+//	gotoon stats [flags] [file ...]
+//	gotoon fmt [flags] [path ...]
+//
+// gotoon reads the named file, or standard input when no file or "-" is
+// given, and writes the converted document to standard output. JSON input
+// is encoded as TOON and TOON input is decoded to JSON. The direction is
+// taken from -encode or -decode, then from a .json or .toon file extension,
+// and otherwise JSON is assumed when the input is valid JSON.
+//
+// Every encoding option of the gotoon package has a flag, except WithStrict
+// and WithKeyCompare: JSON input holds no values that strict mode rejects,
+// and comparison functions cannot be given on the command line.
+//
+// The stats command reports the bytes, lines and tokens of JSON documents
+// as compact JSON, indented JSON and TOON with each delimiter, followed by
+// the layout of every array: inline, tabular or list. Arrays at the same
+// path in different list items are grouped, with their indexes written as
+// []. It accepts the encoding flags, and counts tokens with the tokenizer
+// they select.
+//
+// The fmt command rewrites TOON documents in canonical form with
+// gotoon.Format. Like gofmt, it prints the result to standard output, or
+// with -w writes it back to the file, with -d prints a unified diff and with
+// -l lists the files whose formatting differs. Directories are searched for
+// .toon files.
+//
+// Examples:
+//
+//	gotoon data.json
+//	gotoon -delimiter tab -length-marker < data.json
+//	curl -s https://api.example.com/users | gotoon -sparse empty
+//	gotoon -d -json-indent 0 data.toon
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/k8scat/gotoon"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// errUsage reports invalid flags or arguments, after the usage message has
+// been printed
+var errUsage = errors.New("invalid usage")
+
+// errFailed reports that a command failed after printing its own errors
+var errFailed = errors.New("failed")
+
+// run executes the command with the given arguments and streams, returning
+// the process exit code: 0 on success, 1 on errors and 2 on invalid usage
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var err error
+	switch {
+	case len(args) > 0 && args[0] == "stats":
+		err = stats(args[1:], stdin, stdout, stderr)
+	case len(args) > 0 && args[0] == "fmt":
+		err = formatCommand(args[1:], stdin, stdout, stderr)
+	default:
+		err = convert(args, stdin, stdout, stderr)
+	}
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, errFailed):
+		return 1
+	}
+	fmt.Fprintf(stderr, "gotoon: %v\n", err)
+	return 1
+}
+
+// converter holds the flags of the conversion command
+type converter struct {
+	encode, decode bool
+	output         string
+	jsonIndent     int
+	expandPaths    bool
+	showVersion    bool
+
+	encodeFlags
+}
+
+// convert runs the conversion command
+func convert(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := &converter{}
+	fs := flag.NewFlagSet("gotoon", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gotoon [flags] [file]")
+		fmt.Fprintln(stderr, "       gotoon stats [flags] [file ...]")
+		fmt.Fprintln(stderr, "       gotoon fmt [flags] [path ...]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Converts JSON to TOON and TOON to JSON, reading standard input when no file is given.")
+		fmt.Fprintln(stderr, "Run gotoon stats -h for the size report and gotoon fmt -h for the formatter.")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+
+	fs.BoolVar(&c.encode, "encode", false, "encode JSON input as TOON")
+	fs.BoolVar(&c.encode, "e", false, "shorthand for -encode")
+	fs.BoolVar(&c.decode, "decode", false, "decode TOON input to JSON")
+	fs.BoolVar(&c.decode, "d", false, "shorthand for -decode")
+	fs.StringVar(&c.output, "o", "", "write the output to `file` instead of standard output")
+	fs.IntVar(&c.jsonIndent, "json-indent", 2, "indent JSON output by `n` spaces; 0 writes compact JSON")
+	fs.BoolVar(&c.expandPaths, "expand-paths", false, "split dotted keys such as a.b.c into nested objects when decoding")
+	fs.BoolVar(&c.showVersion, "version", false, "print the version and exit")
+	c.encodeFlags.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if c.showVersion {
+		fmt.Fprintf(stdout, "gotoon %s\n", buildVersion())
+		return nil
+	}
+	if c.encode && c.decode {
+		return usageError(fs, "-encode and -decode cannot be used together")
+	}
+	if fs.NArg() > 1 {
+		return usageError(fs, "at most one input file can be given")
+	}
+
+	opts, err := c.encodeFlags.options()
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+
+	name := fs.Arg(0)
+	input, err := readInput(name, stdin)
+	if err != nil {
+		return err
+	}
+
+	var output []byte
+	if c.encodes(name, input) {
+		encoded, err := gotoon.FromJSON(input, opts...)
+		if err != nil {
+			return err
+		}
+		output = []byte(encoded)
+	} else {
+		var decodeOpts []gotoon.DecodeOption
+		if c.expandPaths {
+			decodeOpts = append(decodeOpts, gotoon.WithPathExpansion())
+		}
+		output, err = gotoon.ToJSON(input, decodeOpts...)
+		if err != nil {
+			return err
+		}
+		if c.jsonIndent > 0 {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, output, "", strings.Repeat(" ", c.jsonIndent)); err != nil {
+				return err
+			}
+			output = indented.Bytes()
+		}
+	}
+
+	return writeOutput(c.output, append(output, '\n'), stdout)
+}
+
+// encodes reports whether the input should be encoded as TOON rather than
+// decoded to JSON
+func (c *converter) encodes(name string, input []byte) bool {
+	switch {
+	case c.encode:
+		return true
+	case c.decode:
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return true
+	case ".toon":
+		return false
+	}
+	return json.Valid(input)
+}
+
+// usageError prints a message and the usage text, returning errUsage
+func usageError(fs *flag.FlagSet, msg string) error {
+	fmt.Fprintf(fs.Output(), "gotoon: %s\n", msg)
+	fs.Usage()
+	return errUsage
+}
+
+// readInput reads the named file, or stdin when the name is empty or "-"
+func readInput(name string, stdin io.Reader) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// writeOutput writes data to the named file, or to stdout when the name is
+// empty or "-"
+func writeOutput(name string, data []byte, stdout io.Writer) error {
+	if name == "" || name == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+// buildVersion returns the version set at build time, or the module version
+// when installed with go install
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
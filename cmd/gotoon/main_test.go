@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand runs the command with the given arguments and stdin, returning
+// its exit code and output
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestConvert(t *testing.T) {
+	const usersJSON = `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]}`
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+	}{
+		{
+			name:     "detect JSON",
+			stdin:    usersJSON,
+			expected: "users[2]{id,name}:\n  1,Alice\n  2,Bob\n",
+		},
+		{
+			name:     "detect TOON",
+			args:     []string{"-json-indent", "0"},
+			stdin:    "users[2]{id,name}:\n  1,Alice\n  2,Bob",
+			expected: usersJSON + "\n",
+		},
+		{
+			name:     "indented JSON",
+			stdin:    "a: 1",
+			expected: "{\n  \"a\": 1\n}\n",
+		},
+		{
+			name:     "encoding flags",
+			args:     []string{"--delimiter", "pipe", "--length-marker", "--indent", "4", "-"},
+			stdin:    usersJSON,
+			expected: "users[#2|]{id|name}:\n    1|Alice\n    2|Bob\n",
+		},
+		{
+			name:     "key flags",
+			args:     []string{"-key-folding", "-key-order", "alphabetical"},
+			stdin:    `{"z":1,"a":{"b":{"c":2}}}`,
+			expected: "a.b.c: 2\nz: 1\n",
+		},
+		{
+			name:     "tabular flags",
+			args:     []string{"-sparse", "null", "-nested-tabular"},
+			stdin:    `[{"id":1,"geo":{"lat":5}},{"id":2}]`,
+			expected: "[2]{id,geo.lat}:\n  1,5\n  2,null\n",
+		},
+		{
+			name:     "truncation flags",
+			args:     []string{"-max-array-items", "1", "-max-string-len", "3"},
+			stdin:    `{"names":["Alice","Bob"]}`,
+			expected: "names[1]: Ali…\n",
+		},
+		{
+			name:     "forced decode",
+			args:     []string{"-d", "-json-indent", "0"},
+			stdin:    "42",
+			expected: "42\n",
+		},
+		{
+			name:     "path expansion",
+			args:     []string{"-decode", "-expand-paths", "-json-indent", "0"},
+			stdin:    "a.b: 1",
+			expected: `{"a":{"b":1}}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCommand(t, tt.stdin, tt.args...)
+			if code != 0 {
+				t.Fatalf("exit code %d: %s", code, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+func TestConvertFiles(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "data.json")
+	output := filepath.Join(dir, "data.toon")
+	if err := os.WriteFile(input, []byte(`{"id":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, stderr := runCommand(t, "", "-o", output, input); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	encoded, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != "id: 1\n" {
+		t.Errorf("unexpected output %q", encoded)
+	}
+
+	// The .toon extension selects decoding
+	code, stdout, stderr := runCommand(t, "", "-json-indent", "0", output)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if stdout != `{"id":1}`+"\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		code    int
+		message string
+	}{
+		{name: "unknown flag", args: []string{"-bogus"}, code: 2, message: "-bogus"},
+		{name: "invalid delimiter", args: []string{"-delimiter", ";"}, code: 2, message: "invalid delimiter"},
+		{name: "invalid sparse mode", args: []string{"-sparse", "some"}, code: 2, message: "invalid sparse mode"},
+		{name: "invalid tokenizer", args: []string{"-tokenizer", "gpt"}, code: 2, message: "invalid tokenizer"},
+		{name: "missing vocabulary", args: []string{"-e", "-token-budget", "10", "-vocab", "missing.tiktoken"}, stdin: "{}", code: 2, message: "missing.tiktoken"},
+		{name: "both directions", args: []string{"-e", "-d"}, code: 2, message: "cannot be used together"},
+		{name: "several files", args: []string{"a.json", "b.json"}, code: 2, message: "at most one"},
+		{name: "missing file", args: []string{"missing.json"}, code: 1, message: "missing.json"},
+		{name: "malformed JSON", args: []string{"-e"}, stdin: `{"a":`, code: 1, message: "gotoon: toon:"},
+		{name: "malformed TOON", stdin: "items[3]: a,b", code: 1, message: "line 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCommand(t, tt.stdin, tt.args...)
+			if code != tt.code {
+				t.Errorf("expected exit code %d, got %d", tt.code, code)
+			}
+			if !strings.Contains(stderr, tt.message) {
+				t.Errorf("expected %q in stderr, got:\n%s", tt.message, stderr)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	code, stdout, _ := runCommand(t, "", "-version")
+	if code != 0 || stdout != "gotoon dev\n" {
+		t.Errorf("unexpected output %q (exit code %d)", stdout, code)
+	}
+}
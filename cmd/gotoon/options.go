@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/k8scat/gotoon"
+)
+
+// encodeFlags holds the flags that map to gotoon encoding options
+type encodeFlags struct {
+	indent          int
+	delimiter       string
+	lengthMarker    bool
+	keyOrder        string
+	maxDepth        int
+	sparse          string
+	sparseThreshold float64
+	keyFolding      bool
+	nestedTabular   bool
+	tokenizer       string
+	vocab           string
+	tokenBudget     int
+	maxArrayItems   int
+	maxStringLen    int
+}
+
+// register defines the encoding flags on fs
+func (f *encodeFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.indent, "indent", 2, "number of spaces per indentation level")
+	fs.StringVar(&f.delimiter, "delimiter", "comma", "delimiter for arrays and tabular rows: comma, tab or pipe")
+	fs.BoolVar(&f.lengthMarker, "length-marker", false, "prefix array lengths with # (e.g. [#3])")
+	fs.StringVar(&f.keyOrder, "key-order", "declaration", "order of object keys: declaration (as in the input) or alphabetical")
+	fs.IntVar(&f.maxDepth, "max-depth", gotoon.DefaultMaxDepth, "maximum nesting of arrays and objects; 0 disables the limit")
+	fs.StringVar(&f.sparse, "sparse", "off", "tabular format for objects with missing fields: off, empty or null")
+	fs.Float64Var(&f.sparseThreshold, "sparse-threshold", gotoon.DefaultSparseThreshold, "largest share of absent cells in a sparse table")
+	fs.BoolVar(&f.keyFolding, "key-folding", false, "collapse chains of single-key objects into dotted keys")
+	fs.BoolVar(&f.nestedTabular, "nested-tabular", false, "flatten nested objects into dotted columns and put primitive arrays in cells")
+	fs.StringVar(&f.tokenizer, "tokenizer", "cl100k", "token counter for -token-budget: cl100k, approx or char")
+	fs.StringVar(&f.vocab, "vocab", "", "count tokens with the BPE vocabulary in `file` (tiktoken format, e.g. o200k_base.tiktoken)")
+	fs.IntVar(&f.tokenBudget, "token-budget", 0, "truncate arrays and strings to fit in `n` tokens; 0 means no budget")
+	fs.IntVar(&f.maxArrayItems, "max-array-items", 0, "encode at most `n` items per array; 0 means no limit")
+	fs.IntVar(&f.maxStringLen, "max-string-len", 0, "encode at most `n` characters per string; 0 means no limit")
+}
+
+// options converts the flags to encoding options. The tokenizer is only
+// loaded for -token-budget, since building the default vocabulary takes
+// much longer than encoding a typical document.
+func (f *encodeFlags) options() ([]gotoon.EncodeOption, error) {
+	if f.indent < 1 {
+		return nil, fmt.Errorf("invalid indent %d: must be at least 1", f.indent)
+	}
+	delimiter, err := parseDelimiter(f.delimiter)
+	if err != nil {
+		return nil, err
+	}
+	opts := []gotoon.EncodeOption{
+		gotoon.WithIndent(f.indent),
+		gotoon.WithDelimiter(delimiter),
+		gotoon.WithMaxDepth(f.maxDepth),
+		gotoon.WithSparseThreshold(f.sparseThreshold),
+		gotoon.WithTokenBudget(f.tokenBudget),
+		gotoon.WithMaxArrayItems(f.maxArrayItems),
+		gotoon.WithMaxStringLen(f.maxStringLen),
+	}
+	if f.lengthMarker {
+		opts = append(opts, gotoon.WithLengthMarker())
+	}
+	if f.keyFolding {
+		opts = append(opts, gotoon.WithKeyFolding())
+	}
+	if f.nestedTabular {
+		opts = append(opts, gotoon.WithNestedTabular())
+	}
+
+	switch f.keyOrder {
+	case "declaration":
+		opts = append(opts, gotoon.WithKeyOrder(gotoon.KeyOrderDeclaration))
+	case "alphabetical":
+		opts = append(opts, gotoon.WithKeyOrder(gotoon.KeyOrderAlphabetical))
+	default:
+		return nil, fmt.Errorf("invalid key order %q: must be declaration or alphabetical", f.keyOrder)
+	}
+
+	switch f.sparse {
+	case "off":
+		opts = append(opts, gotoon.WithSparseTabular(gotoon.SparseOff))
+	case "empty":
+		opts = append(opts, gotoon.WithSparseTabular(gotoon.SparseEmpty))
+	case "null":
+		opts = append(opts, gotoon.WithSparseTabular(gotoon.SparseNull))
+	default:
+		return nil, fmt.Errorf("invalid sparse mode %q: must be off, empty or null", f.sparse)
+	}
+
+	if _, ok := tokenizers[f.tokenizer]; !ok && f.vocab == "" {
+		return nil, fmt.Errorf("invalid tokenizer %q: must be cl100k, approx or char", f.tokenizer)
+	}
+	if f.tokenBudget > 0 {
+		tokenizer, err := f.loadTokenizer()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gotoon.WithTokenizer(tokenizer))
+	}
+	return opts, nil
+}
+
+// tokenizers maps the names accepted by -tokenizer to their constructors
+var tokenizers = map[string]func() gotoon.Tokenizer{
+	"cl100k": func() gotoon.Tokenizer { return gotoon.CL100KBase() },
+	"approx": func() gotoon.Tokenizer { return gotoon.ApproxTokenizer{} },
+	"char":   func() gotoon.Tokenizer { return gotoon.CharTokenizer{} },
+}
+
+// loadTokenizer returns the tokenizer selected by -tokenizer and -vocab
+func (f *encodeFlags) loadTokenizer() (gotoon.Tokenizer, error) {
+	if f.vocab != "" {
+		file, err := os.Open(f.vocab)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return gotoon.NewBPETokenizer(file)
+	}
+
+	newTokenizer, ok := tokenizers[f.tokenizer]
+	if !ok {
+		return nil, fmt.Errorf("invalid tokenizer %q: must be cl100k, approx or char", f.tokenizer)
+	}
+	return newTokenizer(), nil
+}
+
+// parseDelimiter accepts a delimiter by name or as the character itself
+func parseDelimiter(name string) (string, error) {
+	switch name {
+	case "comma", gotoon.DelimiterComma:
+		return gotoon.DelimiterComma, nil
+	case "tab", gotoon.DelimiterTab, `\t`:
+		return gotoon.DelimiterTab, nil
+	case "pipe", gotoon.DelimiterPipe:
+		return gotoon.DelimiterPipe, nil
+	}
+	return "", fmt.Errorf("invalid delimiter %q: must be comma, tab or pipe", name)
+}
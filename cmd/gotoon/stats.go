@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/k8scat/gotoon"
+)
+
+// statsFormat is one representation measured by the stats command
+type statsFormat struct {
+	name   string
+	output []byte
+}
+
+// stats runs the stats command, which compares the size of JSON documents
+// in JSON and TOON and reports how their arrays are encoded
+func stats(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var flags encodeFlags
+	fs := flag.NewFlagSet("gotoon stats", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gotoon stats [flags] [file ...]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Reports bytes, lines and tokens of JSON documents as compact JSON, pretty JSON and")
+		fmt.Fprintln(stderr, "TOON with each delimiter, and whether each array is encoded inline, tabular or as a list.")
+		fmt.Fprintln(stderr, "Reads standard input when no file is given. -delimiter is ignored.")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	flags.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+	tokenizer, err := flags.loadTokenizer()
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	for i, name := range names {
+		input, err := readInput(name, stdin)
+		if err != nil {
+			return err
+		}
+		if len(names) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "==> %s <==\n", name)
+		}
+		if err := writeStats(stdout, input, opts, tokenizer); err != nil {
+			if len(names) > 1 {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStats writes the size table and array layouts of a JSON document
+func writeStats(w io.Writer, input []byte, opts []gotoon.EncodeOption, tokenizer gotoon.Tokenizer) error {
+	var compact, pretty bytes.Buffer
+	if err := json.Compact(&compact, input); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := json.Indent(&pretty, compact.Bytes(), "", "  "); err != nil {
+		return err
+	}
+
+	formats := []statsFormat{
+		{name: "JSON (compact)", output: compact.Bytes()},
+		{name: "JSON (pretty)", output: pretty.Bytes()},
+	}
+	for _, d := range []struct{ name, delimiter string }{
+		{"comma", gotoon.DelimiterComma},
+		{"tab", gotoon.DelimiterTab},
+		{"pipe", gotoon.DelimiterPipe},
+	} {
+		encoded, err := gotoon.FromJSON(input, append(opts, gotoon.WithDelimiter(d.delimiter))...)
+		if err != nil {
+			return err
+		}
+		formats = append(formats, statsFormat{name: "TOON (" + d.name + ")", output: []byte(encoded)})
+	}
+
+	tw := newTable(w)
+	fmt.Fprintln(tw, "format\tbytes\tlines\ttokens\tvs JSON")
+	baseline := tokenizer.CountTokens(compact.String())
+	for _, f := range formats {
+		tokens := tokenizer.CountTokens(string(f.output))
+		change := "-"
+		if f.name != formats[0].name && baseline > 0 {
+			change = fmt.Sprintf("%+.1f%%", (float64(tokens)/float64(baseline)-1)*100)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", f.name, len(f.output), countLines(f.output), tokens, change)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	layouts, err := gotoon.JSONArrayLayouts(input, opts...)
+	if err != nil {
+		return err
+	}
+	if len(layouts) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	return writeArrayLayouts(w, layouts)
+}
+
+// indexPattern matches array indexes in paths
+var indexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// arrayGroup aggregates the arrays sharing a path pattern and format
+type arrayGroup struct {
+	path   string
+	format gotoon.ArrayFormat
+	count  int
+	items  int
+	fields []string
+}
+
+// writeArrayLayouts writes one line per path and format, with array indexes
+// replaced by [] so that arrays nested in every item of a list are grouped
+func writeArrayLayouts(w io.Writer, layouts []gotoon.ArrayLayout) error {
+	var groups []*arrayGroup
+	index := make(map[string]*arrayGroup)
+	for _, l := range layouts {
+		path := indexPattern.ReplaceAllString(l.Path, "[]")
+		if path == "" {
+			path = "(root)"
+		}
+		key := path + "\x00" + l.Format.String()
+		group, ok := index[key]
+		if !ok {
+			group = &arrayGroup{path: path, format: l.Format, fields: l.Fields}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.count++
+		group.items += l.Length
+	}
+
+	tw := newTable(w)
+	fmt.Fprintln(tw, "array\tformat\tarrays\titems\tfields")
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", g.path, g.format, g.count, g.items, strings.Join(g.fields, ","))
+	}
+	return tw.Flush()
+}
+
+// table aligns tab-separated columns, trimming the padding that empty
+// trailing cells would leave at the end of lines
+type table struct {
+	*tabwriter.Writer
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// newTable returns a table that writes to w when flushed
+func newTable(w io.Writer) *table {
+	t := &table{w: w}
+	t.Writer = tabwriter.NewWriter(&t.buf, 0, 0, 2, ' ', 0)
+	return t
+}
+
+// Flush aligns the buffered rows and writes them
+func (t *table) Flush() error {
+	if err := t.Writer.Flush(); err != nil {
+		return err
+	}
+	if t.buf.Len() == 0 {
+		return nil
+	}
+	var out strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(t.buf.String(), "\n"), "\n") {
+		out.WriteString(strings.TrimRight(line, " "))
+		out.WriteByte('\n')
+	}
+	_, err := io.WriteString(t.w, out.String())
+	return err
+}
+
+// countLines returns the number of lines in data
+func countLines(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	return bytes.Count(data, []byte("\n")) + 1
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("report", func(t *testing.T) {
+		code, stdout, stderr := runCommand(t, `{"users":[{"id":1,"name":"Al"}],"tags":[]}`, "stats", "-tokenizer", "char")
+		if code != 0 {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		expected := strings.Join([]string{
+			"format          bytes  lines  tokens  vs JSON",
+			"JSON (compact)  42     1      11      -",
+			"JSON (pretty)   80     9      20      +81.8%",
+			"TOON (comma)    34     3      9       -18.2%",
+			"TOON (tab)      36     3      9       -18.2%",
+			"TOON (pipe)     36     3      9       -18.2%",
+			"",
+			"array  format   arrays  items  fields",
+			"users  tabular  1       1      id,name",
+			"tags   inline   1       0",
+			"",
+		}, "\n")
+		if stdout != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, stdout)
+		}
+	})
+
+	t.Run("grouped arrays", func(t *testing.T) {
+		input := `{"groups":[{"tags":["a"],"rows":[{"a":1}]},{"tags":["b","c"],"x":1}]}`
+		code, stdout, stderr := runCommand(t, input, "stats")
+		if code != 0 {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		_, layouts, _ := strings.Cut(stdout, "\n\n")
+		expected := strings.Join([]string{
+			"array          format   arrays  items  fields",
+			"groups         list     1       2",
+			"groups[].tags  inline   2       3",
+			"groups[].rows  tabular  1       1      a",
+			"",
+		}, "\n")
+		if layouts != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, layouts)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		input := `{"rows":[{"id":1,"geo":{"lat":5}}]}`
+		_, stdout, _ := runCommand(t, input, "stats")
+		if !strings.Contains(stdout, "rows   list") {
+			t.Errorf("expected a list array without options, got:\n%s", stdout)
+		}
+		_, stdout, _ = runCommand(t, input, "stats", "-nested-tabular")
+		if !strings.Contains(stdout, "rows   tabular  1       1      id,geo.lat") {
+			t.Errorf("expected a tabular array with -nested-tabular, got:\n%s", stdout)
+		}
+	})
+
+	t.Run("several files", func(t *testing.T) {
+		dir := t.TempDir()
+		a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+		for _, name := range []string{a, b} {
+			if err := os.WriteFile(name, []byte(`{"id":1}`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		code, stdout, stderr := runCommand(t, "", "stats", a, b)
+		if code != 0 {
+			t.Fatalf("exit code %d: %s", code, stderr)
+		}
+		if !strings.HasPrefix(stdout, "==> "+a+" <==\n") || !strings.Contains(stdout, "\n\n==> "+b+" <==\n") {
+			t.Errorf("expected a header per file, got:\n%s", stdout)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if code, _, stderr := runCommand(t, "a: 1", "stats"); code != 1 || !strings.Contains(stderr, "invalid JSON") {
+			t.Errorf("expected an invalid JSON error, got exit code %d: %s", code, stderr)
+		}
+		if code, _, _ := runCommand(t, "{}", "stats", "-sparse", "x"); code != 2 {
+			t.Errorf("expected exit code 2, got %d", code)
+		}
+	})
+}
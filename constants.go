@@ -47,3 +47,10 @@ const (
 
 // DefaultDelimiter is the default delimiter for arrays and tabular data
 const DefaultDelimiter = DelimiterComma
+
+// DefaultMaxDepth is the default maximum nesting depth of encoded values
+const DefaultMaxDepth = 1000
+
+// DefaultSparseThreshold is the default largest share of absent cells in a
+// sparse tabular array
+const DefaultSparseThreshold = 0.5
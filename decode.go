@@ -0,0 +1,816 @@
+package gotoon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError describes malformed TOON input
+type SyntaxError struct {
+	// Line is the 1-based line number where the error was detected
+	Line int
+
+	// Msg describes the problem
+	Msg string
+}
+
+// Error implements the error interface
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("toon: line %d: %s", e.Line, e.Msg)
+}
+
+// line is a single non-blank line of TOON input
+type line struct {
+	num    int
+	depth  int
+	indent int
+	text   string
+}
+
+// indentTracker converts leading spaces into nesting depth. The indentation
+// size is inferred from the first indented line of the document.
+type indentTracker struct {
+	size int
+}
+
+// depth returns the nesting depth for the given number of leading spaces
+func (t *indentTracker) depth(indent int) (int, error) {
+	if indent == 0 {
+		return 0, nil
+	}
+	if t.size == 0 {
+		t.size = indent
+	}
+	if indent%t.size != 0 {
+		return 0, fmt.Errorf("indentation of %d spaces is not a multiple of %d", indent, t.size)
+	}
+	return indent / t.size, nil
+}
+
+// scanLine splits a raw line into its indentation and content
+func scanLine(raw string) (indent int, text string, err error) {
+	raw = strings.TrimSuffix(raw, CarriageReturn)
+	for indent < len(raw) && raw[indent] == ' ' {
+		indent++
+	}
+	text = raw[indent:]
+	if strings.HasPrefix(text, Tab) && strings.TrimSpace(text) != "" {
+		return 0, "", errors.New("tabs are not allowed in indentation")
+	}
+	return indent, text, nil
+}
+
+// splitLines splits TOON input into non-blank lines with their depths
+func splitLines(input string) ([]line, error) {
+	var tracker indentTracker
+	var lines []line
+	for i, raw := range strings.Split(input, Newline) {
+		indent, text, err := scanLine(raw)
+		if err != nil {
+			return nil, &SyntaxError{Line: i + 1, Msg: err.Error()}
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		depth, err := tracker.depth(indent)
+		if err != nil {
+			return nil, &SyntaxError{Line: i + 1, Msg: err.Error()}
+		}
+		lines = append(lines, line{num: i + 1, depth: depth, indent: indent, text: text})
+	}
+	return lines, nil
+}
+
+// fieldHeader is the parsed form of a "key[N]{fields}: rest" line
+type fieldHeader struct {
+	key       string
+	quoted    bool
+	isArray   bool
+	length    int
+	delimiter string
+	fields    []string
+	rest      string
+
+	// quotedFields reports which field names were quoted
+	quotedFields []bool
+}
+
+// keyless reports whether the header is an array without a key, as in
+// "[N]: ...". A quoted empty key ("") is a key like any other.
+func (h fieldHeader) keyless() bool {
+	return h.isArray && h.key == "" && !h.quoted
+}
+
+// parseFieldHeader parses a key line. It reports ok=false if the text is not
+// a key line at all, such as a tabular row or a bare primitive.
+func parseFieldHeader(text string) (h fieldHeader, ok bool, err error) {
+	i := 0
+	if strings.HasPrefix(text, DoubleQuote) {
+		key, n, err := parseQuotedString(text)
+		if err != nil {
+			return h, false, err
+		}
+		h.key = key
+		h.quoted = true
+		i = n
+	} else {
+		i = strings.IndexAny(text, `:[]{}"`)
+		if i < 0 || (text[i] != ':' && text[i] != '[') {
+			return h, false, nil
+		}
+		h.key = strings.TrimSpace(text[:i])
+		if h.key == "" && text[i] != '[' {
+			return h, false, nil
+		}
+	}
+
+	if i < len(text) && text[i] == '[' {
+		n, err := parseArrayHeader(text[i:], &h)
+		if err != nil {
+			return h, false, err
+		}
+		i += n
+	}
+
+	if i >= len(text) || text[i] != ':' {
+		if h.isArray {
+			return h, false, errors.New("missing colon after array header")
+		}
+		return h, false, nil
+	}
+
+	h.rest = strings.Trim(text[i+1:], Space)
+	return h, true, nil
+}
+
+// parseArrayHeader parses the "[N]" and optional "{fields}" segments of a
+// header, returning the number of bytes consumed
+func parseArrayHeader(text string, h *fieldHeader) (int, error) {
+	end := strings.Index(text, CloseBracket)
+	if end < 0 {
+		return 0, errors.New("unterminated array length")
+	}
+
+	inner := strings.TrimPrefix(text[1:end], "#")
+	h.isArray = true
+	h.delimiter = DefaultDelimiter
+	if strings.HasSuffix(inner, DelimiterTab) || strings.HasSuffix(inner, DelimiterPipe) {
+		h.delimiter = inner[len(inner)-1:]
+		inner = inner[:len(inner)-1]
+	}
+
+	length, err := strconv.Atoi(inner)
+	if err != nil || length < 0 {
+		return 0, fmt.Errorf("invalid array length %q", text[1:end])
+	}
+	h.length = length
+
+	n := end + 1
+	if n < len(text) && text[n] == '{' {
+		closing := indexUnquoted(text[n:], '}')
+		if closing < 0 {
+			return 0, errors.New("unterminated field list")
+		}
+		tokens := splitDelimited(text[n+1:n+closing], h.delimiter)
+		h.fields = make([]string, len(tokens))
+		h.quotedFields = make([]bool, len(tokens))
+		for i, token := range tokens {
+			field, err := parseKeyToken(token)
+			if err != nil {
+				return 0, err
+			}
+			h.fields[i] = field
+			h.quotedFields[i] = strings.HasPrefix(strings.TrimSpace(token), DoubleQuote)
+		}
+		n += closing + 1
+	}
+
+	return n, nil
+}
+
+// parseKeyToken parses a single, possibly quoted, field name
+func parseKeyToken(token string) (string, error) {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, DoubleQuote) {
+		if token == "" {
+			return "", errors.New("empty field name")
+		}
+		return token, nil
+	}
+	key, n, err := parseQuotedString(token)
+	if err != nil {
+		return "", err
+	}
+	if n != len(token) {
+		return "", fmt.Errorf("unexpected characters after quoted field %q", key)
+	}
+	return key, nil
+}
+
+// parseQuotedString parses a quoted string at the start of s, returning the
+// unescaped value and the number of bytes consumed
+func parseQuotedString(s string) (string, int, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return sb.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, errors.New("unterminated string")
+			}
+			i++
+			switch s[i] {
+			case '\\':
+				sb.WriteByte('\\')
+			case '"':
+				sb.WriteByte('"')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				return "", 0, fmt.Errorf("invalid escape sequence \\%c", s[i])
+			}
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+// indexUnquoted returns the index of the first c in s outside quotes, or -1
+func indexUnquoted(s string, c byte) int {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuotes && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitDelimited splits s on the delimiter, ignoring delimiters inside quotes
+func splitDelimited(s string, delimiter string) []string {
+	var tokens []string
+	for {
+		i := indexUnquoted(s, delimiter[0])
+		if i < 0 {
+			return append(tokens, s)
+		}
+		tokens = append(tokens, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// splitCells splits a tabular row on the delimiter, ignoring delimiters
+// inside quotes and inside bracketed array cells
+func splitCells(s string, delimiter string) []string {
+	var tokens []string
+	inQuotes := false
+	brackets := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuotes && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case s[i] == '[':
+			brackets++
+		case s[i] == ']' && brackets > 0:
+			brackets--
+		case brackets == 0 && s[i] == delimiter[0]:
+			tokens = append(tokens, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(tokens, s[start:])
+}
+
+// isEmptyCell checks if a tabular cell is empty, marking a field that is
+// absent from a sparse row
+func isEmptyCell(token string) bool {
+	return strings.TrimSpace(token) == ""
+}
+
+// isListItem checks if a line is a list item ("- value" or a bare "-")
+func isListItem(text string) bool {
+	return text == ListItemMarker || strings.HasPrefix(text, ListItemPrefix)
+}
+
+// isRowLine checks if a line is a tabular row rather than a key or list item
+func isRowLine(text string) bool {
+	if isListItem(text) {
+		return false
+	}
+	_, ok, err := parseFieldHeader(text)
+	return err != nil || !ok
+}
+
+var decimalPattern = regexp.MustCompile(`^-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][+-]?\d+)?$`)
+
+// parser builds a value tree from TOON lines
+type parser struct {
+	lines []line
+	pos   int
+
+	// useNumber keeps numbers as json.Number so callers can convert them
+	// to their target type without going through float64
+	useNumber bool
+
+	// expandPaths splits unquoted dotted keys into nested objects
+	expandPaths bool
+
+	// diagnostics, when set, collects length and field count mismatches,
+	// inconsistent indentation and malformed values instead of failing on
+	// the first one
+	diagnostics *diagnostics
+}
+
+// peek returns the next unconsumed line
+func (p *parser) peek() (line, bool) {
+	if p.pos >= len(p.lines) {
+		return line{}, false
+	}
+	return p.lines[p.pos], true
+}
+
+// syntaxErrorf returns a SyntaxError for the given line
+func syntaxErrorf(l line, format string, args ...interface{}) error {
+	return &SyntaxError{Line: l.num, Msg: fmt.Sprintf(format, args...)}
+}
+
+// reportf reports a problem the parser can recover from at byte offset col
+// of line l. It returns a SyntaxError unless diagnostics are collected.
+func (p *parser) reportf(l line, col int, format string, args ...interface{}) error {
+	if p.diagnostics == nil {
+		return syntaxErrorf(l, format, args...)
+	}
+	p.diagnostics.add(l.num, l.indent+col+1, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// valueError reports a malformed value on line l. When diagnostics are
+// collected the value is treated as null and parsing continues.
+func (p *parser) valueError(l line, err error) error {
+	if p.diagnostics == nil {
+		return wrapSyntaxError(l, err)
+	}
+	p.diagnostics.addValueError(l, err)
+	return nil
+}
+
+// headerColumn returns the offset of the array length in a header line
+func headerColumn(l line) int {
+	return max(indexUnquoted(l.text, '['), 0)
+}
+
+// wrapSyntaxError converts a plain error into a SyntaxError for the given line
+func wrapSyntaxError(l line, err error) error {
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return err
+	}
+	return &SyntaxError{Line: l.num, Msg: err.Error()}
+}
+
+// parseDocument parses the whole input as a root object, array or primitive.
+// Objects are returned as *object so they keep the order of their keys.
+func (p *parser) parseDocument() (interface{}, error) {
+	if len(p.lines) == 0 {
+		return newObject(0), nil
+	}
+
+	first := p.lines[0]
+	if first.depth != 0 {
+		return nil, syntaxErrorf(first, "unexpected indentation")
+	}
+
+	h, ok, err := parseFieldHeader(first.text)
+	if err != nil {
+		return nil, wrapSyntaxError(first, err)
+	}
+
+	// Root array: "[N]: ..." without a key
+	if ok && h.keyless() {
+		p.pos++
+		arr, err := p.parseArray(first, h)
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); ok {
+			return nil, syntaxErrorf(next, "unexpected content after root array")
+		}
+		return arr, nil
+	}
+
+	// Root primitive: a single line that is not a key
+	if !ok {
+		if len(p.lines) > 1 {
+			return nil, syntaxErrorf(first, "expected key")
+		}
+		value, err := p.parsePrimitive(first.text)
+		if err != nil {
+			return nil, p.valueError(first, err)
+		}
+		return value, nil
+	}
+
+	obj := newObject(0)
+	if err := p.parseObject(0, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// parseObject reads key lines at the given depth into obj
+func (p *parser) parseObject(depth int, obj *object) error {
+	for {
+		l, ok := p.peek()
+		if !ok || l.depth < depth {
+			return nil
+		}
+		if l.depth > depth {
+			return syntaxErrorf(l, "unexpected indentation")
+		}
+		if isListItem(l.text) {
+			return syntaxErrorf(l, "unexpected list item")
+		}
+		p.pos++
+		if err := p.parseField(l, l.text, depth+1, obj); err != nil {
+			return err
+		}
+	}
+}
+
+// parseField parses a single key line into obj. childDepth is the depth at
+// which the fields of a nested object are expected.
+func (p *parser) parseField(l line, text string, childDepth int, obj *object) error {
+	h, ok, err := parseFieldHeader(text)
+	if err != nil {
+		return wrapSyntaxError(l, err)
+	}
+	if !ok {
+		return syntaxErrorf(l, "expected key")
+	}
+	if h.keyless() {
+		return syntaxErrorf(l, "missing key")
+	}
+
+	value, err := p.parseFieldValue(l, h, childDepth)
+	if err != nil {
+		return err
+	}
+	return p.setField(l, h.key, h.quoted, obj, value)
+}
+
+// setField stores the value of a key line in obj. With path expansion, an
+// unquoted dotted key is split into nested objects, which are merged with
+// any objects already in obj.
+func (p *parser) setField(l line, key string, quoted bool, obj *object, value interface{}) error {
+	if !p.expandPaths {
+		obj.set(key, value)
+		return nil
+	}
+
+	path := []string{key}
+	if !quoted && isExpandablePath(key) {
+		path = strings.Split(key, ".")
+	}
+	last := len(path) - 1
+	for _, segment := range path[:last] {
+		existing, exists := obj.get(segment)
+		nested, ok := existing.(*object)
+		if !ok {
+			if exists {
+				return syntaxErrorf(l, "path %q conflicts with an existing value", key)
+			}
+			nested = newObject(1)
+			obj.set(segment, nested)
+		}
+		obj = nested
+	}
+
+	if !mergeField(obj, path[last], value) {
+		return syntaxErrorf(l, "path %q conflicts with an existing value", key)
+	}
+	return nil
+}
+
+// mergeField stores value under key in obj, merging objects recursively. It
+// reports false if key already holds a value that cannot be merged.
+func mergeField(obj *object, key string, value interface{}) bool {
+	existing, exists := obj.get(key)
+	if !exists {
+		obj.set(key, value)
+		return true
+	}
+
+	dst, ok := existing.(*object)
+	src, ok2 := value.(*object)
+	if !ok || !ok2 {
+		return false
+	}
+	for _, k := range src.keys {
+		if !mergeField(dst, k, src.values[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isExpandablePath checks if a key is a dotted path of identifier segments
+func isExpandablePath(key string) bool {
+	if !strings.Contains(key, ".") {
+		return false
+	}
+	for _, segment := range strings.Split(key, ".") {
+		if !isIdentifierSegment(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseFieldValue parses the value introduced by a key line
+func (p *parser) parseFieldValue(l line, h fieldHeader, childDepth int) (interface{}, error) {
+	if h.isArray {
+		return p.parseArray(l, h)
+	}
+
+	if h.rest != "" {
+		value, err := p.parsePrimitive(h.rest)
+		if err != nil {
+			return nil, p.valueError(l, err)
+		}
+		return value, nil
+	}
+
+	// Nested object, or an empty object when nothing is indented below
+	nested := newObject(0)
+	if next, ok := p.peek(); ok && next.depth >= childDepth {
+		if err := p.parseObject(childDepth, nested); err != nil {
+			return nil, err
+		}
+	}
+	return nested, nil
+}
+
+// parseArray parses the body of an array whose header is on line l
+func (p *parser) parseArray(l line, h fieldHeader) (interface{}, error) {
+	if h.rest != "" {
+		if h.fields != nil {
+			return nil, syntaxErrorf(l, "tabular header cannot have inline values")
+		}
+		tokens := splitDelimited(h.rest, h.delimiter)
+		arr := make([]interface{}, len(tokens))
+		for i, token := range tokens {
+			value, err := p.parsePrimitive(token)
+			if err != nil {
+				if err := p.valueError(l, err); err != nil {
+					return nil, err
+				}
+			}
+			arr[i] = value
+		}
+		if len(arr) != h.length {
+			if err := p.reportf(l, headerColumn(l), "array declares %d values, found %d", h.length, len(arr)); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+
+	if h.fields != nil {
+		return p.parseRows(l, h)
+	}
+	return p.parseListItems(l, h)
+}
+
+// parseRows parses the rows of a tabular array into objects
+func (p *parser) parseRows(l line, h fieldHeader) (interface{}, error) {
+	rows := make([]interface{}, 0, h.length)
+	rowDepth := -1
+	for {
+		next, ok := p.peek()
+		if !ok || next.depth <= l.depth || !isRowLine(next.text) {
+			break
+		}
+		if rowDepth < 0 {
+			rowDepth = next.depth
+		} else if next.depth != rowDepth {
+			if err := p.reportf(next, 0, "inconsistent row indentation"); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+
+		row := newObject(len(h.fields))
+		tokens := splitCells(next.text, h.delimiter)
+		if len(tokens) != len(h.fields) {
+			if err := p.reportf(next, cellColumn(tokens, len(h.fields)), "row has %d values, header declares %d fields", len(tokens), len(h.fields)); err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+			continue
+		}
+		for i, token := range tokens {
+			if isEmptyCell(token) {
+				// Sparse rows leave absent fields empty
+				continue
+			}
+			value, err := decodeCell(token, h.delimiter, p.useNumber)
+			if err != nil {
+				if err := p.valueError(next, err); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.setField(next, h.fields[i], h.quotedFields[i], row, value); err != nil {
+				return nil, err
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) != h.length {
+		if err := p.reportf(l, headerColumn(l), "array declares %d rows, found %d", h.length, len(rows)); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// cellColumn returns the offset in a row where a cell count mismatch shows:
+// the first extra cell, or the end of the row when cells are missing
+func cellColumn(tokens []string, fields int) int {
+	col := 0
+	for i, token := range tokens {
+		if i == fields {
+			return col
+		}
+		col += len(token) + 1
+	}
+	return col - 1
+}
+
+// parseListItems parses the "- " items of an expanded array
+func (p *parser) parseListItems(l line, h fieldHeader) (interface{}, error) {
+	items := make([]interface{}, 0, h.length)
+	itemDepth := -1
+	for {
+		next, ok := p.peek()
+		if !ok || next.depth <= l.depth || !isListItem(next.text) {
+			break
+		}
+		if itemDepth < 0 {
+			itemDepth = next.depth
+		} else if next.depth != itemDepth {
+			if err := p.reportf(next, 0, "inconsistent list item indentation"); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+
+		item, err := p.parseListItem(next)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if len(items) != h.length {
+		if err := p.reportf(l, headerColumn(l), "array declares %d items, found %d", h.length, len(items)); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// parseListItem parses a single list item and any lines that belong to it
+func (p *parser) parseListItem(l line) (interface{}, error) {
+	content := strings.TrimPrefix(strings.TrimPrefix(l.text, ListItemMarker), Space)
+	if content == "" {
+		return newObject(0), nil
+	}
+
+	h, ok, err := parseFieldHeader(content)
+	if err != nil {
+		return nil, wrapSyntaxError(l, err)
+	}
+	if !ok {
+		value, err := p.parsePrimitive(content)
+		if err != nil {
+			return nil, p.valueError(l, err)
+		}
+		return value, nil
+	}
+
+	// Nested array as a list item: "- [N]: ..."
+	if h.keyless() {
+		return p.parseArray(l, h)
+	}
+
+	// Object as a list item: the first field shares the "- " line, nested
+	// fields of that first field sit two levels deeper and the remaining
+	// fields one level deeper
+	obj := newObject(0)
+	value, err := p.parseFieldValue(l, h, l.depth+2)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.setField(l, h.key, h.quoted, obj, value); err != nil {
+		return nil, err
+	}
+
+	if err := p.parseObject(l.depth+1, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// parsePrimitive parses a single primitive token
+func (p *parser) parsePrimitive(token string) (interface{}, error) {
+	return decodePrimitive(token, p.useNumber)
+}
+
+// decodeCell parses a tabular cell, which holds a primitive or a bracketed
+// array of primitives
+func decodeCell(token string, delimiter string, useNumber bool) (interface{}, error) {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, OpenBracket) {
+		return decodePrimitive(token, useNumber)
+	}
+	if !strings.HasSuffix(token, CloseBracket) {
+		return nil, fmt.Errorf("unterminated array cell %q", token)
+	}
+
+	items := []interface{}{}
+	inner := token[1 : len(token)-1]
+	if strings.TrimSpace(inner) == "" {
+		return items, nil
+	}
+	for _, item := range splitDelimited(inner, delimiter) {
+		value, err := decodePrimitive(item, useNumber)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+// decodePrimitive parses a single primitive token, returning numbers as
+// json.Number when useNumber is set
+func decodePrimitive(token string, useNumber bool) (interface{}, error) {
+	token = strings.TrimSpace(token)
+
+	if strings.HasPrefix(token, DoubleQuote) {
+		value, n, err := parseQuotedString(token)
+		if err != nil {
+			return nil, err
+		}
+		if n != len(token) {
+			return nil, fmt.Errorf("unexpected characters after quoted string %q", value)
+		}
+		return value, nil
+	}
+
+	switch token {
+	case NullLiteral:
+		return nil, nil
+	case TrueLiteral:
+		return true, nil
+	case FalseLiteral:
+		return false, nil
+	}
+
+	if decimalPattern.MatchString(token) {
+		if useNumber {
+			return json.Number(token), nil
+		}
+		f, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		// Normalize -0 to 0
+		if f == 0 {
+			return 0.0, nil
+		}
+		return f, nil
+	}
+
+	return token, nil
+}
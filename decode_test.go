@@ -0,0 +1,394 @@
+package gotoon
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{
+			name:     "empty document",
+			input:    "",
+			expected: map[string]interface{}{},
+		},
+		{
+			name:  "array cells",
+			input: "[2]{id,tags}:\n  [1,2],[a,\"b,c\"]\n  3,[]",
+			expected: []interface{}{
+				map[string]interface{}{"id": []interface{}{1.0, 2.0}, "tags": []interface{}{"a", "b,c"}},
+				map[string]interface{}{"id": 3.0, "tags": []interface{}{}},
+			},
+		},
+		{
+			name:     "quoted empty keys",
+			input:    "\"\": 1\n\"\"[2]: a,b",
+			expected: map[string]interface{}{"": []interface{}{"a", "b"}},
+		},
+		{
+			name:     "quoted empty key in list item",
+			input:    "[1]:\n  - \"\": 1",
+			expected: []interface{}{map[string]interface{}{"": 1.0}},
+		},
+		{
+			name:     "root primitive",
+			input:    "hello world",
+			expected: "hello world",
+		},
+		{
+			name:     "root quoted primitive",
+			input:    "\"true\"",
+			expected: "true",
+		},
+		{
+			name:     "root number",
+			input:    "-3.5",
+			expected: -3.5,
+		},
+		{
+			name:  "simple object",
+			input: "id: 123\nname: Ada\nactive: true\nnote: null",
+			expected: map[string]interface{}{
+				"id":     123.0,
+				"name":   "Ada",
+				"active": true,
+				"note":   nil,
+			},
+		},
+		{
+			name:  "nested and empty objects",
+			input: "user:\n  id: 1\n  prefs:\n    theme: dark\n  meta:",
+			expected: map[string]interface{}{
+				"user": map[string]interface{}{
+					"id":    1.0,
+					"prefs": map[string]interface{}{"theme": "dark"},
+					"meta":  map[string]interface{}{},
+				},
+			},
+		},
+		{
+			name:  "inline array",
+			input: "tags[3]: admin,ops,dev\nempty[0]:",
+			expected: map[string]interface{}{
+				"tags":  []interface{}{"admin", "ops", "dev"},
+				"empty": []interface{}{},
+			},
+		},
+		{
+			name:  "tabular array",
+			input: "users[2]{id,name,role}:\n  1,Alice,admin\n  2,Bob,user",
+			expected: map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"id": 1.0, "name": "Alice", "role": "admin"},
+					map[string]interface{}{"id": 2.0, "name": "Bob", "role": "user"},
+				},
+			},
+		},
+		{
+			name:  "tab delimiter with length marker",
+			input: "users[#2\t]{id\tname}:\n  1\tAlice Smith\n  2\tBob",
+			expected: map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"id": 1.0, "name": "Alice Smith"},
+					map[string]interface{}{"id": 2.0, "name": "Bob"},
+				},
+			},
+		},
+		{
+			name:  "pipe delimiter",
+			input: "tags[2|]: a,b|c",
+			expected: map[string]interface{}{
+				"tags": []interface{}{"a,b", "c"},
+			},
+		},
+		{
+			name:  "mixed list",
+			input: "items[4]:\n  - 1\n  - text\n  - a: 1\n    b: 2\n  - [2]: x,y",
+			expected: map[string]interface{}{
+				"items": []interface{}{
+					1.0,
+					"text",
+					map[string]interface{}{"a": 1.0, "b": 2.0},
+					[]interface{}{"x", "y"},
+				},
+			},
+		},
+		{
+			name:  "list item with nested fields",
+			input: "[2]:\n  - rows[2]{a,b}:\n    1,2\n    3,4\n    name: x\n  - user:\n      id: 1\n    tags[1]: t",
+			expected: []interface{}{
+				map[string]interface{}{
+					"rows": []interface{}{
+						map[string]interface{}{"a": 1.0, "b": 2.0},
+						map[string]interface{}{"a": 3.0, "b": 4.0},
+					},
+					"name": "x",
+				},
+				map[string]interface{}{
+					"user": map[string]interface{}{"id": 1.0},
+					"tags": []interface{}{"t"},
+				},
+			},
+		},
+		{
+			name:  "quoted keys and escapes",
+			input: "\"my key\": \"say \\\"hi\\\"\\n\"\n\"a:b\"[1]: \"x, y\"",
+			expected: map[string]interface{}{
+				"my key": "say \"hi\"\n",
+				"a:b":    []interface{}{"x, y"},
+			},
+		},
+		{
+			name:  "four space indentation",
+			input: "user:\n    id: 1\n    tags[2]: a,b",
+			expected: map[string]interface{}{
+				"user": map[string]interface{}{
+					"id":   1.0,
+					"tags": []interface{}{"a", "b"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Decode(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected:\n%#v\n\ngot:\n%#v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	inputs := []interface{}{
+		map[string]interface{}{
+			"users": []map[string]interface{}{
+				{"id": 1, "name": "Alice", "role": "admin"},
+				{"id": 2, "name": "Bob", "role": "user"},
+			},
+		},
+		map[string]interface{}{
+			"items": []interface{}{
+				1,
+				"text",
+				map[string]interface{}{"a": 1, "nested": map[string]interface{}{"b": true}},
+				[]int{1, 2},
+			},
+		},
+		map[string]interface{}{
+			"matrix": [][]int{{1, 2}, {3, 4}},
+			"note":   "hello, world",
+			"quote":  "say \"hi\"",
+			"empty":  "",
+			"flags":  []string{"true", "42", "-x"},
+		},
+		map[string]interface{}{
+			"orders": []interface{}{
+				map[string]interface{}{
+					"id": "A",
+					"lines": []map[string]interface{}{
+						{"sku": "X", "qty": 2},
+						{"sku": "Y", "qty": 1},
+					},
+				},
+				map[string]interface{}{
+					"customer": map[string]interface{}{"name": "Ada"},
+					"total":    9.5,
+				},
+			},
+		},
+		[]interface{}{"a", 1.5, nil, false},
+		map[string]interface{}{
+			"":      1,
+			"inner": map[string]interface{}{"": "x"},
+			"rows":  []map[string]interface{}{{"": 1}, {"": 2}},
+		},
+		[]interface{}{
+			map[string]interface{}{"": []string{"x"}},
+			map[string]interface{}{"": []map[string]interface{}{{"a": 1}, {"a": 2}}, "b": 1},
+			map[string]interface{}{"": []interface{}{1, map[string]interface{}{"a": 1}}},
+		},
+	}
+
+	optionSets := [][]EncodeOption{
+		nil,
+		{WithDelimiter("\t")},
+		{WithDelimiter("|"), WithLengthMarker()},
+		{WithIndent(4)},
+	}
+
+	for _, input := range inputs {
+		for _, opts := range optionSets {
+			encoded, err := Encode(input, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			decoded, err := Decode(encoded)
+			if err != nil {
+				t.Fatalf("decode failed: %v\n%s", err, encoded)
+			}
+			normalized, err := normalizeValue(input, defaultOptions())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := plainValue(normalized); !reflect.DeepEqual(decoded, expected) {
+				t.Errorf("round trip mismatch for:\n%s\n\nexpected:\n%#v\n\ngot:\n%#v", encoded, expected, decoded)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+	}{
+		{name: "inline length mismatch", input: "tags[3]: a,b", line: 1},
+		{name: "row count mismatch", input: "a: 1\nrows[3]{x}:\n  1\n  2", line: 2},
+		{name: "row field count", input: "rows[1]{x,y}:\n  1", line: 2},
+		{name: "list length mismatch", input: "items[1]:\n  - a\n  - b", line: 1},
+		{name: "unterminated string", input: "a: \"oops", line: 1},
+		{name: "invalid escape", input: "a: \"\\x\"", line: 1},
+		{name: "bad indentation", input: "a:\n  b: 1\n   c: 2", line: 3},
+		{name: "unexpected indentation", input: "a: 1\n  b: 2", line: 2},
+		{name: "missing colon", input: "a: 1\nb", line: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.input)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected *SyntaxError, got %v", err)
+			}
+			if syntaxErr.Line != tt.line {
+				t.Errorf("expected error on line %d, got %v", tt.line, err)
+			}
+		})
+	}
+}
+
+func TestDecodePathExpansion(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{
+			name:     "dotted key",
+			input:    "config.db.host: x",
+			expected: map[string]interface{}{"config": map[string]interface{}{"db": map[string]interface{}{"host": "x"}}},
+		},
+		{
+			name:  "merges shared prefixes",
+			input: "a.b: 1\na.c[2]: x,y\na:\n  d: 2",
+			expected: map[string]interface{}{"a": map[string]interface{}{
+				"b": 1.0,
+				"c": []interface{}{"x", "y"},
+				"d": 2.0,
+			}},
+		},
+		{
+			name:     "quoted keys stay literal",
+			input:    "\"a.b\": 1",
+			expected: map[string]interface{}{"a.b": 1.0},
+		},
+		{
+			name:     "segments that are not identifiers",
+			input:    "a..b: 1\nv1.2: 2",
+			expected: map[string]interface{}{"a..b": 1.0, "v1.2": 2.0},
+		},
+		{
+			name:     "list item keys",
+			input:    "[1]:\n  - a.b: 1\n    a.c: 2",
+			expected: []interface{}{map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": 2.0}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Decode(tt.input, WithPathExpansion())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		result, err := Decode("a.b: 1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := map[string]interface{}{"a.b": 1.0}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %#v, got %#v", expected, result)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		_, err := Decode("a: 1\nb: 2\na.b: 3", WithPathExpansion())
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || syntaxErr.Line != 3 {
+			t.Fatalf("expected *SyntaxError on line 3, got %v", err)
+		}
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		var config struct {
+			DB struct {
+				Host string `json:"host"`
+				Port int    `json:"port"`
+			} `json:"db"`
+		}
+		if err := Unmarshal([]byte("db.host: x\ndb.port: 5432"), &config, WithPathExpansion()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.DB.Host != "x" || config.DB.Port != 5432 {
+			t.Errorf("unexpected result %+v", config)
+		}
+	})
+}
+
+// plainValue converts a normalized value to the shapes returned by Decode
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *object:
+		m := make(map[string]interface{}, v.len())
+		for _, key := range v.keys {
+			m[key] = plainValue(v.values[key])
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = plainValue(item)
+		}
+		return arr
+	case listArray:
+		return plainValue([]interface{}(v))
+	case quotedString:
+		return string(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
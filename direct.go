@@ -0,0 +1,537 @@
+package gotoon
+
+import (
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// directEncoder writes TOON straight from reflected Go values in a single
+// pass, choosing the array strategy (inline, tabular or list) from the
+// static types involved. Values whose shape is only known once normalized,
+// such as maps, interfaces, marshalers and non-uniform arrays, are
+// normalized and handed to the generic encoder for that subtree only.
+type directEncoder struct {
+	n      *normalizer
+	writer *LineWriter
+	opts   *EncodeOptions
+
+	// ordered holds the fields of each struct type in key order when the
+	// options reorder keys
+	ordered map[reflect.Type][]field
+}
+
+// encodeDirect encodes any Go value as lines on the given writer
+func encodeDirect(value interface{}, writer *LineWriter, opts *EncodeOptions) error {
+	e := &directEncoder{
+		n:      &normalizer{opts: opts},
+		writer: writer,
+		opts:   opts,
+	}
+	if value == nil {
+		writer.Push(0, NullLiteral)
+		return nil
+	}
+	if opts.KeyFolding {
+		// Folding looks ahead at which fields of nested objects are present,
+		// so it encodes from the normalized tree
+		normalized, err := e.n.normalizeInterface(value)
+		if err != nil {
+			return err
+		}
+		encodeValueTo(normalized, writer, opts)
+		return nil
+	}
+	return e.encodeRoot(reflect.ValueOf(value))
+}
+
+// encodeRoot encodes the top-level value
+func (e *directEncoder) encodeRoot(v reflect.Value) error {
+	switch directKindOf(v.Type()) {
+	case directStruct:
+		return e.encodeObject(v, 0)
+
+	case directArray:
+		return e.encodeArray("", v, 0)
+
+	case directPointer:
+		if !v.IsNil() {
+			if err := e.n.enter(v); err != nil {
+				return err
+			}
+			defer e.n.leave(v)
+			return e.encodeRoot(v.Elem())
+		}
+	}
+
+	normalized, err := e.n.normalize(v)
+	if err != nil {
+		return err
+	}
+	encodeValueTo(normalized, e.writer, e.opts)
+	return nil
+}
+
+// encodeObject encodes the fields of a struct at the given depth
+func (e *directEncoder) encodeObject(v reflect.Value, depth int) error {
+	if err := e.n.enter(v); err != nil {
+		return err
+	}
+	defer e.n.leave(v)
+
+	for _, f := range e.fields(v.Type()) {
+		fieldValue, ok := fieldByIndex(v, f.index)
+		if !ok || f.omit(fieldValue) {
+			continue
+		}
+		if err := e.encodeField(f, fieldValue, depth); err != nil {
+			return prefixPath(err, f.name)
+		}
+	}
+	return nil
+}
+
+// encodeField encodes a single struct field as a key-value pair
+func (e *directEncoder) encodeField(f field, v reflect.Value, depth int) error {
+	if !f.asString && !f.quote && !f.list {
+		switch directKindOf(v.Type()) {
+		case directScalar:
+			s, err := e.formatScalar(v)
+			if err != nil {
+				return err
+			}
+			e.writer.Push(depth, encodeLiteralKey(f.name, e.opts)+Colon+Space+s)
+			return nil
+
+		case directStruct:
+			e.writer.Push(depth, encodeLiteralKey(f.name, e.opts)+Colon)
+			return e.encodeObject(v, depth+1)
+
+		case directArray:
+			return e.encodeArray(encodeLiteralKey(f.name, e.opts), v, depth)
+
+		case directPointer:
+			if v.IsNil() {
+				e.writer.Push(depth, encodeLiteralKey(f.name, e.opts)+Colon+Space+NullLiteral)
+				return nil
+			}
+			if err := e.n.enter(v); err != nil {
+				return err
+			}
+			defer e.n.leave(v)
+			return e.encodeField(f, v.Elem(), depth)
+		}
+	}
+
+	// Fall back to the normalized form
+	normalized, err := e.normalizeField(f, v)
+	if err != nil {
+		return err
+	}
+	encodeKeyValuePair(encodeLiteralKey(f.name, e.opts), normalized, e.writer, depth, e.opts)
+	return nil
+}
+
+// encodeArray encodes a slice or array, choosing inline or tabular format
+// from its element type and falling back to the generic encoder otherwise.
+// prefix is the encoded key of the array, or empty for an array without one.
+func (e *directEncoder) encodeArray(prefix string, v reflect.Value, depth int) error {
+	if err := e.n.enter(v); err != nil {
+		return err
+	}
+	defer e.n.leave(v)
+
+	if v.Len() == 0 {
+		e.writer.Push(depth, formatHeader(0, headerOptions{
+			key:          prefix,
+			delimiter:    e.opts.Delimiter,
+			lengthMarker: e.opts.LengthMarker,
+		}))
+		return nil
+	}
+
+	elemType := v.Type().Elem()
+	if isScalarType(elemType) {
+		return e.encodeInlineArray(prefix, v, depth)
+	}
+
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if directKindOf(structType) == directStruct && (structType == elemType || !hasNilElement(v)) {
+		if fields, ok := e.tabularFields(v, structType); ok {
+			return e.encodeTabularArray(prefix, v, fields, depth)
+		}
+	}
+
+	// Fall back to the normalized form
+	normalized, err := e.normalizeElements(v)
+	if err != nil {
+		return err
+	}
+	encodeArray(prefix, normalized, e.writer, depth, e.opts)
+	return nil
+}
+
+// encodeInlineArray encodes an array of scalars on a single line
+func (e *directEncoder) encodeInlineArray(prefix string, v reflect.Value, depth int) error {
+	var sb strings.Builder
+	sb.WriteString(formatHeader(v.Len(), headerOptions{
+		key:          prefix,
+		delimiter:    e.opts.Delimiter,
+		lengthMarker: e.opts.LengthMarker,
+	}))
+	sb.WriteString(Space)
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			sb.WriteString(e.opts.Delimiter)
+		}
+		s, err := e.formatScalar(v.Index(i))
+		if err != nil {
+			return prefixPath(err, indexPath("", i))
+		}
+		sb.WriteString(s)
+	}
+	e.writer.Push(depth, sb.String())
+	return nil
+}
+
+// tabularFields returns the columns for an array of structs, or of non-nil
+// pointers to structs, reporting ok=false unless every row has the same
+// fields and they all hold primitives
+func (e *directEncoder) tabularFields(v reflect.Value, structType reflect.Type) ([]field, bool) {
+	info := tabularTypeOf(structType)
+	if !info.primitive {
+		return nil, false
+	}
+	fields := e.fields(structType)
+	if !info.optional {
+		return fields, true
+	}
+
+	// Omitted fields must be omitted from every row alike
+	present := make([]bool, len(fields))
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		for j, f := range fields {
+			fieldValue, ok := fieldByIndex(row, f.index)
+			ok = ok && !f.omit(fieldValue)
+			if i == 0 {
+				present[j] = ok
+			} else if present[j] != ok {
+				return nil, false
+			}
+		}
+	}
+
+	columns := make([]field, 0, len(fields))
+	for j, f := range fields {
+		if present[j] {
+			columns = append(columns, f)
+		}
+	}
+	return columns, len(columns) > 0
+}
+
+// encodeTabularArray encodes an array of structs, or of non-nil pointers to
+// structs, as a table with the given fields as columns
+func (e *directEncoder) encodeTabularArray(prefix string, v reflect.Value, fields []field, depth int) error {
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.name
+		if f.header != "" {
+			columns[i] = f.header
+		}
+	}
+	e.writer.Push(depth, formatHeader(v.Len(), headerOptions{
+		key:          prefix,
+		fields:       encodeColumns(columns, false, e.opts),
+		delimiter:    e.opts.Delimiter,
+		lengthMarker: e.opts.LengthMarker,
+	}))
+
+	var sb strings.Builder
+	for i := 0; i < v.Len(); i++ {
+		sb.Reset()
+		if err := e.writeRow(&sb, v.Index(i), fields); err != nil {
+			return prefixPath(err, indexPath("", i))
+		}
+		e.writer.Push(depth+1, sb.String())
+	}
+	return nil
+}
+
+// writeRow writes the delimited cells of one tabular row
+func (e *directEncoder) writeRow(sb *strings.Builder, row reflect.Value, fields []field) error {
+	if row.Kind() == reflect.Ptr {
+		row = row.Elem()
+	}
+	if err := e.n.enter(row); err != nil {
+		return err
+	}
+	defer e.n.leave(row)
+
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteString(e.opts.Delimiter)
+		}
+		fieldValue, _ := fieldByIndex(row, f.index)
+		var s string
+		var err error
+		if f.asString || f.quote {
+			var normalized interface{}
+			normalized, err = e.normalizeField(f, fieldValue)
+			s = encodePrimitive(normalized, e.opts.Delimiter)
+		} else {
+			s, err = e.formatScalar(fieldValue)
+		}
+		if err != nil {
+			return prefixPath(err, f.name)
+		}
+		sb.WriteString(s)
+	}
+	return nil
+}
+
+// formatScalar encodes a value whose type satisfies isScalarType
+func (e *directEncoder) formatScalar(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return NullLiteral, nil
+		}
+		v = v.Elem()
+	}
+
+	if directKindOf(v.Type()) == directScalar {
+		switch v.Kind() {
+		case reflect.Bool:
+			if v.Bool() {
+				return TrueLiteral, nil
+			}
+			return FalseLiteral, nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(v.Int(), 10), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return strconv.FormatUint(v.Uint(), 10), nil
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if !math.IsNaN(f) && !math.IsInf(f, 0) {
+				if f == 0 {
+					// Normalize -0 to 0
+					f = 0
+				}
+				return formatNumber(f), nil
+			}
+		case reflect.String:
+			return encodeStringLiteral(v.String(), e.opts.Delimiter), nil
+		}
+	}
+
+	// Times, exact numbers, text marshalers and special floats
+	normalized, err := e.n.normalize(v)
+	if err != nil {
+		return "", err
+	}
+	return encodePrimitive(normalized, e.opts.Delimiter), nil
+}
+
+// normalizeField normalizes a field value and applies its tag options
+func (e *directEncoder) normalizeField(f field, v reflect.Value) (interface{}, error) {
+	var normalized interface{}
+	var err error
+	if f.asString {
+		normalized, err = e.n.stringFieldValue(v)
+	} else {
+		normalized, err = e.n.normalize(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.applyOptions(normalized), nil
+}
+
+// normalizeElements normalizes the elements of an array that is already
+// being tracked for depth and cycles
+func (e *directEncoder) normalizeElements(v reflect.Value) ([]interface{}, error) {
+	elemFunc := typeNormalizer(v.Type().Elem())
+	arr := make([]interface{}, v.Len())
+	for i := range arr {
+		item, err := e.n.normalizeWith(elemFunc, v.Index(i))
+		if err != nil {
+			return nil, prefixPath(err, indexPath("", i))
+		}
+		arr[i] = item
+	}
+	return arr, nil
+}
+
+// fields returns the fields of a struct type in the key order selected by
+// the options
+func (e *directEncoder) fields(t reflect.Type) []field {
+	fields := cachedTypeFields(t)
+	if e.opts.KeyCompare == nil && e.opts.KeyOrder == KeyOrderDeclaration {
+		return fields
+	}
+
+	if ordered, ok := e.ordered[t]; ok {
+		return ordered
+	}
+	ordered := slices.Clone(fields)
+	if e.opts.KeyCompare != nil {
+		slices.SortStableFunc(ordered, func(a, b field) int {
+			return e.opts.KeyCompare(a.name, b.name)
+		})
+	} else {
+		slices.SortStableFunc(ordered, func(a, b field) int {
+			return strings.Compare(a.name, b.name)
+		})
+	}
+	if e.ordered == nil {
+		e.ordered = make(map[reflect.Type][]field)
+	}
+	e.ordered[t] = ordered
+	return ordered
+}
+
+// hasNilElement reports whether a slice or array of pointers holds a nil
+func hasNilElement(v reflect.Value) bool {
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).IsNil() {
+			return true
+		}
+	}
+	return false
+}
+
+// directKind classifies how the direct encoder handles a type
+type directKind int
+
+const (
+	// directFallback types are normalized and encoded generically
+	directFallback directKind = iota
+
+	// directScalar types are bool, integer, float and string kinds without
+	// marshaler methods
+	directScalar
+
+	// directStruct types are structs without marshaler methods
+	directStruct
+
+	// directArray types are slices and arrays without marshaler methods
+	directArray
+
+	// directPointer types point to a type that is not a fallback
+	directPointer
+)
+
+// directKindCache maps each reflect.Type to its directKind
+var directKindCache sync.Map
+
+// directKindOf returns the directKind of a type, caching the result
+func directKindOf(t reflect.Type) directKind {
+	if k, ok := directKindCache.Load(t); ok {
+		return k.(directKind)
+	}
+	k, _ := directKindCache.LoadOrStore(t, newDirectKind(t))
+	return k.(directKind)
+}
+
+// newDirectKind classifies a type for the direct encoder
+func newDirectKind(t reflect.Type) directKind {
+	if t == timeType || isNumberType(t) {
+		return directFallback
+	}
+	if t.Kind() == reflect.Ptr {
+		if directKindOf(t.Elem()) != directFallback {
+			return directPointer
+		}
+		return directFallback
+	}
+	if marshalerKindOf(t) != noMarshaler || marshalerKindOf(reflect.PointerTo(t)) != noMarshaler {
+		return directFallback
+	}
+
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		return directScalar
+	case reflect.Struct:
+		return directStruct
+	case reflect.Slice, reflect.Array:
+		return directArray
+	}
+	return directFallback
+}
+
+// isScalarType reports whether every value of a type normalizes to a
+// primitive: scalar kinds, times, exact numbers, types whose only marshaler
+// is encoding.TextMarshaler, and pointers to any of these
+func isScalarType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if directKindOf(t) == directScalar || t == timeType || isNumberType(t) {
+		return true
+	}
+	return marshalerKindOf(t) == textMarshaler && marshalerKindOf(reflect.PointerTo(t)) == textMarshaler
+}
+
+// tabularType describes whether arrays of a struct type can be encoded in
+// tabular format
+type tabularType struct {
+	// primitive is set when every field normalizes to a primitive
+	primitive bool
+
+	// optional is set when some fields may be missing from some rows,
+	// through omitempty, omitzero or a nil embedded pointer
+	optional bool
+}
+
+// tabularTypeCache maps each struct type to its tabularType
+var tabularTypeCache sync.Map
+
+// tabularTypeOf returns the tabularType of a struct type, caching the result
+func tabularTypeOf(t reflect.Type) tabularType {
+	if info, ok := tabularTypeCache.Load(t); ok {
+		return info.(tabularType)
+	}
+	info, _ := tabularTypeCache.LoadOrStore(t, newTabularType(t))
+	return info.(tabularType)
+}
+
+// newTabularType computes the tabularType of a struct type
+func newTabularType(t reflect.Type) tabularType {
+	var info tabularType
+	fields := cachedTypeFields(t)
+	if len(fields) == 0 {
+		return info
+	}
+	for _, f := range fields {
+		if f.list {
+			return info
+		}
+		if f.omitEmpty || f.omitZero {
+			info.optional = true
+		}
+		ft := t
+		for i, x := range f.index {
+			if i > 0 && ft.Kind() == reflect.Ptr {
+				info.optional = true
+				ft = ft.Elem()
+			}
+			ft = ft.Field(x).Type
+		}
+		if !f.asString && !isScalarType(ft) {
+			return info
+		}
+	}
+	info.primitive = true
+	return info
+}
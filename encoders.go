@@ -2,7 +2,7 @@ package gotoon
 
 import (
 	"fmt"
-	"sort"
+	"strings"
 )
 
 // encodeValue encodes a normalized value to TOON format
@@ -12,45 +12,68 @@ func encodeValue(value interface{}, opts *EncodeOptions) string {
 	}
 
 	writer := NewLineWriter(opts.Indent)
+	encodeValueTo(value, writer, opts)
+	return writer.String()
+}
 
-	if arr, ok := value.([]interface{}); ok {
+// encodeValueTo encodes a normalized value as lines on the given writer
+func encodeValueTo(value interface{}, writer *LineWriter, opts *EncodeOptions) {
+	if isPrimitive(value) {
+		writer.Push(0, encodePrimitive(value, opts.Delimiter))
+	} else if arr, ok := value.([]interface{}); ok {
 		encodeArray("", arr, writer, 0, opts)
-	} else if obj, ok := value.(map[string]interface{}); ok {
+	} else if obj, ok := value.(*object); ok {
 		encodeObject(obj, writer, 0, opts)
 	}
+}
 
-	return writer.String()
+// encodeObject encodes an object to TOON format
+func encodeObject(obj *object, writer *LineWriter, depth int, opts *EncodeOptions) {
+	for _, key := range obj.orderedKeys(opts) {
+		encodedKey, value := foldKey(obj, key, opts)
+		encodeKeyValuePair(encodedKey, value, writer, depth, opts)
+	}
 }
 
-// encodeObject encodes an object (map) to TOON format
-func encodeObject(obj map[string]interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
-	// Sort keys for deterministic output
-	keys := make([]string, 0, len(obj))
-	for k := range obj {
-		keys = append(keys, k)
+// foldKey returns the encoded key and the value to write for a field of
+// obj. With key folding, a chain of single-key objects collapses into a
+// dotted key, stopping at a segment that is not a plain identifier or where
+// the dotted key would collide with a sibling key.
+func foldKey(obj *object, key string, opts *EncodeOptions) (string, interface{}) {
+	value := obj.values[key]
+	if !opts.KeyFolding || !isIdentifierSegment(key) {
+		return encodeLiteralKey(key, opts), value
 	}
-	sort.Strings(keys)
 
-	for _, key := range keys {
-		encodeKeyValuePair(key, obj[key], writer, depth, opts)
+	folded := key
+	for {
+		nested, ok := value.(*object)
+		if !ok || nested.len() != 1 {
+			break
+		}
+		next := nested.keys[0]
+		if !isIdentifierSegment(next) {
+			break
+		}
+		candidate := folded + "." + next
+		if _, exists := obj.get(candidate); exists {
+			break
+		}
+		folded, value = candidate, nested.values[next]
 	}
+	return folded, value
 }
 
-// encodeKeyValuePair encodes a single key-value pair
-func encodeKeyValuePair(key string, value interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
-	encodedKey := encodeKey(key)
-
+// encodeKeyValuePair encodes a single key-value pair under an encoded key
+func encodeKeyValuePair(encodedKey string, value interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
 	if isPrimitive(value) {
 		writer.Push(depth, fmt.Sprintf("%s: %s", encodedKey, encodePrimitive(value, opts.Delimiter)))
+	} else if arr, ok := value.(listArray); ok {
+		encodeMixedArrayAsListItems(encodedKey, arr, writer, depth, opts)
 	} else if arr, ok := value.([]interface{}); ok {
-		encodeArray(key, arr, writer, depth, opts)
-	} else if obj, ok := value.(map[string]interface{}); ok {
-		keys := make([]string, 0, len(obj))
-		for k := range obj {
-			keys = append(keys, k)
-		}
-
-		if len(keys) == 0 {
+		encodeArray(encodedKey, arr, writer, depth, opts)
+	} else if obj, ok := value.(*object); ok {
+		if obj.len() == 0 {
 			// Empty object
 			writer.Push(depth, encodedKey+Colon)
 		} else {
@@ -60,59 +83,57 @@ func encodeKeyValuePair(key string, value interface{}, writer *LineWriter, depth
 	}
 }
 
-// encodeArray encodes an array with various strategies based on content
-func encodeArray(key string, arr []interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
-	if len(arr) == 0 {
-		header := formatHeader(0, headerOptions{
-			key:          key,
-			delimiter:    opts.Delimiter,
-			lengthMarker: opts.LengthMarker,
-		})
-		writer.Push(depth, header)
-		return
-	}
+// tabularArray holds the rows of an array of objects in tabular format, as
+// returned by tabularRows
+type tabularArray struct {
+	rows      []*object
+	header    []string
+	flattened bool
+}
 
-	// Strategy 1: Primitive array (inline)
+// arrayFormat selects the format of an array that is the root, a field
+// value or the first field of a list item: inline for primitives and empty
+// arrays, tabular for objects that tabularRows accepts, and list otherwise.
+// The rows of a tabular array are returned with it. Arrays forced into list
+// format with the toon "list" option are listArray values and never get
+// here.
+func arrayFormat(arr []interface{}, opts *EncodeOptions) (ArrayFormat, *tabularArray) {
 	if isArrayOfPrimitives(arr) {
-		encodeInlinePrimitiveArray(key, arr, writer, depth, opts)
-		return
-	}
-
-	// Strategy 2: Array of arrays (all primitives)
-	if isArrayOfArrays(arr) {
-		allPrimitiveArrays := true
-		for _, item := range arr {
-			if itemArr, ok := item.([]interface{}); ok {
-				if !isArrayOfPrimitives(itemArr) {
-					allPrimitiveArrays = false
-					break
-				}
-			}
-		}
-		if allPrimitiveArrays {
-			encodeArrayOfArraysAsListItems(key, arr, writer, depth, opts)
-			return
-		}
+		return ArrayInline, nil
 	}
-
-	// Strategy 3: Array of objects (try tabular format)
 	if isArrayOfObjects(arr) {
-		objects := make([]map[string]interface{}, len(arr))
+		objects := make([]*object, len(arr))
 		for i, item := range arr {
-			objects[i] = item.(map[string]interface{})
+			objects[i] = item.(*object)
 		}
-
-		header := detectTabularHeader(objects)
-		if header != nil {
-			encodeArrayOfObjectsAsTabular(key, objects, header, writer, depth, opts)
-		} else {
-			encodeMixedArrayAsListItems(key, arr, writer, depth, opts)
+		if rows, header, flattened := tabularRows(objects, opts); header != nil {
+			return ArrayTabular, &tabularArray{rows: rows, header: header, flattened: flattened}
 		}
-		return
 	}
+	return ArrayList, nil
+}
 
-	// Strategy 4: Mixed array (fallback to list format)
-	encodeMixedArrayAsListItems(key, arr, writer, depth, opts)
+// listItemArrayFormat selects the format of an array that is itself a list
+// item, which is inline for primitives and never tabular
+func listItemArrayFormat(arr []interface{}) ArrayFormat {
+	if isArrayOfPrimitives(arr) {
+		return ArrayInline
+	}
+	return ArrayList
+}
+
+// encodeArray encodes an array in the format chosen by arrayFormat. prefix
+// is the encoded key of the array, or empty for an array without one.
+func encodeArray(prefix string, arr []interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
+	format, table := arrayFormat(arr, opts)
+	switch format {
+	case ArrayInline:
+		encodeInlinePrimitiveArray(prefix, arr, writer, depth, opts)
+	case ArrayTabular:
+		encodeArrayOfObjectsAsTabular(prefix, table.rows, table.header, table.flattened, writer, depth, opts)
+	default:
+		encodeMixedArrayAsListItems(prefix, arr, writer, depth, opts)
+	}
 }
 
 // encodeInlinePrimitiveArray encodes a primitive array in inline format
@@ -121,65 +142,89 @@ func encodeInlinePrimitiveArray(prefix string, values []interface{}, writer *Lin
 	writer.Push(depth, formatted)
 }
 
-// encodeArrayOfArraysAsListItems encodes an array of primitive arrays in list format
-func encodeArrayOfArraysAsListItems(prefix string, arrays []interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
-	header := formatHeader(len(arrays), headerOptions{
-		key:          prefix,
-		delimiter:    opts.Delimiter,
-		lengthMarker: opts.LengthMarker,
-	})
-	writer.Push(depth, header)
-
-	for _, item := range arrays {
-		if arr, ok := item.([]interface{}); ok && isArrayOfPrimitives(arr) {
-			inline := formatInlineArray(arr, opts.Delimiter, "", opts.LengthMarker)
-			writer.Push(depth+1, ListItemPrefix+inline)
-		}
-	}
-}
-
 // detectTabularHeader detects if an array of objects can use tabular format
-func detectTabularHeader(objects []map[string]interface{}) []string {
+func detectTabularHeader(objects []*object, opts *EncodeOptions) []string {
 	if len(objects) == 0 {
 		return nil
 	}
 
 	// Get keys from first object
 	firstObj := objects[0]
-	if len(firstObj) == 0 {
+	if firstObj.len() == 0 {
 		return nil
 	}
 
-	// Extract and sort keys for deterministic output
-	firstKeys := make([]string, 0, len(firstObj))
-	for k := range firstObj {
-		firstKeys = append(firstKeys, k)
-	}
-	sort.Strings(firstKeys)
+	// Columns follow the key order of the first object
+	firstKeys := firstObj.orderedKeys(opts)
 
 	// Check if all objects have the same keys with primitive values
-	if isTabularArray(objects, firstKeys) {
+	if isTabularArray(objects, firstKeys, opts) {
 		return firstKeys
 	}
 
+	if opts.Sparse != SparseOff {
+		return sparseTabularHeader(objects, opts)
+	}
 	return nil
 }
 
-// isTabularArray checks if all objects have the same keys and only primitive values
-func isTabularArray(objects []map[string]interface{}, header []string) bool {
+// sparseTabularHeader returns the union of the keys of all objects as
+// columns, provided every value is primitive, every object has at least one
+// key and the share of absent cells is within the sparse threshold
+func sparseTabularHeader(objects []*object, opts *EncodeOptions) []string {
+	var header []string
+	seen := make(map[string]bool)
+	present := 0
+	for _, obj := range objects {
+		if obj.len() == 0 {
+			return nil
+		}
+		for _, key := range obj.keys {
+			if !isTabularCell(obj.values[key], opts) {
+				return nil
+			}
+			if !seen[key] {
+				seen[key] = true
+				header = append(header, key)
+			}
+		}
+		present += obj.len()
+	}
+	sortKeys(header, opts)
+
+	cells := len(objects) * len(header)
+	if float64(cells-present)/float64(cells) > opts.SparseThreshold {
+		return nil
+	}
+
+	// A row cannot start with an empty cell when tabs delimit the cells,
+	// since a leading tab reads as indentation
+	if opts.Sparse == SparseEmpty && opts.Delimiter == DelimiterTab {
+		for _, obj := range objects {
+			if _, ok := obj.get(header[0]); !ok {
+				return nil
+			}
+		}
+	}
+	return header
+}
+
+// isTabularArray checks if all objects have the same keys and only values
+// that fit in a tabular cell
+func isTabularArray(objects []*object, header []string, opts *EncodeOptions) bool {
 	for _, obj := range objects {
 		// All objects must have the same number of keys
-		if len(obj) != len(header) {
+		if obj.len() != len(header) {
 			return false
 		}
 
 		// Check that all header keys exist and values are primitives
 		for _, key := range header {
-			value, exists := obj[key]
+			value, exists := obj.get(key)
 			if !exists {
 				return false
 			}
-			if !isPrimitive(value) {
+			if !isTabularCell(value, opts) {
 				return false
 			}
 		}
@@ -188,11 +233,75 @@ func isTabularArray(objects []map[string]interface{}, header []string) bool {
 	return true
 }
 
+// isTabularCell checks if a value fits in a tabular cell: a primitive or,
+// with nested tabular encoding, an array of primitives
+func isTabularCell(value interface{}, opts *EncodeOptions) bool {
+	if isPrimitive(value) {
+		return true
+	}
+	arr, ok := value.([]interface{})
+	return ok && opts.NestedTabular && isArrayOfPrimitives(arr)
+}
+
+// tabularRows returns the rows and columns for encoding an array of objects
+// in tabular format, or a nil header when it needs list format. With nested
+// tabular encoding, rows whose nested objects keep them from being tabular
+// are flattened into dotted columns, and flattened reports that the dots in
+// the column names are paths.
+func tabularRows(objects []*object, opts *EncodeOptions) (rows []*object, header []string, flattened bool) {
+	if header := detectTabularHeader(objects, opts); header != nil || !opts.NestedTabular {
+		return objects, header, false
+	}
+
+	rows = make([]*object, len(objects))
+	for i, obj := range objects {
+		flat := newObject(obj.len())
+		if !flattenRow(flat, obj, "", "", opts) {
+			return objects, nil, false
+		}
+		rows[i] = flat
+	}
+	return rows, detectTabularHeader(rows, opts), true
+}
+
+// flattenRow adds the fields of obj to flat, with the fields of nested
+// objects under dotted keys. It reports false when a nested object is empty,
+// when a key at any level is not a plain identifier, which would make the
+// dotted columns ambiguous, or when two keys collide.
+func flattenRow(flat, obj *object, prefix, headerPrefix string, opts *EncodeOptions) bool {
+	for _, key := range obj.orderedKeys(opts) {
+		if !isIdentifierSegment(key) {
+			return false
+		}
+		name, header := key, obj.header(key)
+		if prefix != "" {
+			name, header = prefix+"."+key, headerPrefix+"."+header
+		}
+
+		value := obj.values[key]
+		if nested, ok := value.(*object); ok {
+			if nested.len() == 0 || !flattenRow(flat, nested, name, header, opts) {
+				return false
+			}
+			continue
+		}
+
+		if _, exists := flat.get(name); exists {
+			return false
+		}
+		flat.set(name, value)
+		if header != name {
+			flat.setHeader(name, header)
+		}
+	}
+	return true
+}
+
 // encodeArrayOfObjectsAsTabular encodes an array of uniform objects in tabular format
-func encodeArrayOfObjectsAsTabular(prefix string, objects []map[string]interface{}, header []string, writer *LineWriter, depth int, opts *EncodeOptions) {
+func encodeArrayOfObjectsAsTabular(prefix string, objects []*object, header []string, flattened bool, writer *LineWriter, depth int, opts *EncodeOptions) {
 	headerStr := formatHeader(len(objects), headerOptions{
 		key:          prefix,
-		fields:       header,
+		fields:       encodeColumns(columnNames(objects, header), flattened, opts),
 		delimiter:    opts.Delimiter,
 		lengthMarker: opts.LengthMarker,
 	})
@@ -201,15 +310,51 @@ func encodeArrayOfObjectsAsTabular(prefix string, objects []map[string]interface
 	writeTabularRows(objects, header, writer, depth+1, opts)
 }
 
-// writeTabularRows writes the data rows for a tabular array
-func writeTabularRows(objects []map[string]interface{}, header []string, writer *LineWriter, depth int, opts *EncodeOptions) {
+// columnNames maps tabular keys to their column names, which differ when a
+// struct field sets a toon header option. Each key takes its name from the
+// first object that has it.
+func columnNames(objects []*object, header []string) []string {
+	names := make([]string, len(header))
+	for i, key := range header {
+		names[i] = key
+		for _, obj := range objects {
+			if _, ok := obj.get(key); ok {
+				names[i] = obj.header(key)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// encodeColumns encodes the column names of a table. The dotted names of
+// flattened rows are paths; other names are literal keys.
+func encodeColumns(names []string, flattened bool, opts *EncodeOptions) []string {
+	encoded := make([]string, len(names))
+	for i, name := range names {
+		if flattened {
+			encoded[i] = encodeKey(name)
+		} else {
+			encoded[i] = encodeLiteralKey(name, opts)
+		}
+	}
+	return encoded
+}
+
+// writeTabularRows writes the data rows for a tabular array. Keys absent
+// from a sparse row are written as empty cells or null.
+func writeTabularRows(objects []*object, header []string, writer *LineWriter, depth int, opts *EncodeOptions) {
+	cells := make([]string, len(header))
 	for _, obj := range objects {
-		values := make([]interface{}, len(header))
 		for i, key := range header {
-			values[i] = obj[key]
+			value, ok := obj.get(key)
+			if !ok && opts.Sparse == SparseEmpty {
+				cells[i] = ""
+				continue
+			}
+			cells[i] = encodeCell(value, opts.Delimiter)
 		}
-		joined := joinEncodedValues(values, opts.Delimiter)
-		writer.Push(depth, joined)
+		writer.Push(depth, strings.Join(cells, opts.Delimiter))
 	}
 }
 
@@ -222,31 +367,39 @@ func encodeMixedArrayAsListItems(prefix string, items []interface{}, writer *Lin
 	})
 	writer.Push(depth, header)
 
+	encodeListItems(items, writer, depth+1, opts)
+}
+
+// encodeListItems encodes array items as "- " lines at the given depth
+func encodeListItems(items []interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
 	for _, item := range items {
 		if isPrimitive(item) {
 			// Direct primitive as list item
-			writer.Push(depth+1, ListItemPrefix+encodePrimitive(item, opts.Delimiter))
+			writer.Push(depth, ListItemPrefix+encodePrimitive(item, opts.Delimiter))
 		} else if arr, ok := item.([]interface{}); ok {
 			// Direct array as list item
-			if isArrayOfPrimitives(arr) {
+			if listItemArrayFormat(arr) == ArrayInline {
 				inline := formatInlineArray(arr, opts.Delimiter, "", opts.LengthMarker)
-				writer.Push(depth+1, ListItemPrefix+inline)
+				writer.Push(depth, ListItemPrefix+inline)
+			} else {
+				// Nested arrays of objects or arrays as their own list
+				header := formatHeader(len(arr), headerOptions{
+					delimiter:    opts.Delimiter,
+					lengthMarker: opts.LengthMarker,
+				})
+				writer.Push(depth, ListItemPrefix+header)
+				encodeListItems(arr, writer, depth+1, opts)
 			}
-		} else if obj, ok := item.(map[string]interface{}); ok {
+		} else if obj, ok := item.(*object); ok {
 			// Object as list item
-			encodeObjectAsListItem(obj, writer, depth+1, opts)
+			encodeObjectAsListItem(obj, writer, depth, opts)
 		}
 	}
 }
 
 // encodeObjectAsListItem encodes an object as a list item
-func encodeObjectAsListItem(obj map[string]interface{}, writer *LineWriter, depth int, opts *EncodeOptions) {
-	// Sort keys for deterministic output
-	keys := make([]string, 0, len(obj))
-	for k := range obj {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+func encodeObjectAsListItem(obj *object, writer *LineWriter, depth int, opts *EncodeOptions) {
+	keys := obj.orderedKeys(opts)
 
 	if len(keys) == 0 {
 		writer.Push(depth, ListItemMarker)
@@ -254,66 +407,35 @@ func encodeObjectAsListItem(obj map[string]interface{}, writer *LineWriter, dept
 	}
 
 	// First key-value on the same line as "- "
-	firstKey := keys[0]
-	encodedKey := encodeKey(firstKey)
-	firstValue := obj[firstKey]
+	encodedKey, firstValue := foldKey(obj, keys[0], opts)
 
 	if isPrimitive(firstValue) {
 		writer.Push(depth, fmt.Sprintf("%s%s: %s", ListItemPrefix, encodedKey, encodePrimitive(firstValue, opts.Delimiter)))
+	} else if arr, ok := firstValue.(listArray); ok {
+		// Forced list format
+		writer.Push(depth, fmt.Sprintf("%s%s[%d]:", ListItemPrefix, encodedKey, len(arr)))
+		encodeListItems(arr, writer, depth+1, opts)
 	} else if arr, ok := firstValue.([]interface{}); ok {
-		if isArrayOfPrimitives(arr) {
-			// Inline format for primitive arrays
-			formatted := formatInlineArray(arr, opts.Delimiter, firstKey, opts.LengthMarker)
+		switch format, table := arrayFormat(arr, opts); format {
+		case ArrayInline:
+			formatted := formatInlineArray(arr, opts.Delimiter, encodedKey, opts.LengthMarker)
 			writer.Push(depth, ListItemPrefix+formatted)
-		} else if isArrayOfObjects(arr) {
-			// Check if array of objects can use tabular format
-			objects := make([]map[string]interface{}, len(arr))
-			for i, item := range arr {
-				objects[i] = item.(map[string]interface{})
-			}
-
-			header := detectTabularHeader(objects)
-			if header != nil {
-				// Tabular format
-				headerStr := formatHeader(len(arr), headerOptions{
-					key:          firstKey,
-					fields:       header,
-					delimiter:    opts.Delimiter,
-					lengthMarker: opts.LengthMarker,
-				})
-				writer.Push(depth, ListItemPrefix+headerStr)
-				writeTabularRows(objects, header, writer, depth+1, opts)
-			} else {
-				// Fall back to list format
-				writer.Push(depth, fmt.Sprintf("%s%s[%d]:", ListItemPrefix, encodedKey, len(arr)))
-				for _, item := range arr {
-					if itemObj, ok := item.(map[string]interface{}); ok {
-						encodeObjectAsListItem(itemObj, writer, depth+1, opts)
-					}
-				}
-			}
-		} else {
+		case ArrayTabular:
+			headerStr := formatHeader(len(arr), headerOptions{
+				key:          encodedKey,
+				fields:       encodeColumns(columnNames(table.rows, table.header), table.flattened, opts),
+				delimiter:    opts.Delimiter,
+				lengthMarker: opts.LengthMarker,
+			})
+			writer.Push(depth, ListItemPrefix+headerStr)
+			writeTabularRows(table.rows, table.header, writer, depth+1, opts)
+		default:
 			// Complex arrays on separate lines
 			writer.Push(depth, fmt.Sprintf("%s%s[%d]:", ListItemPrefix, encodedKey, len(arr)))
-
-			for _, item := range arr {
-				if isPrimitive(item) {
-					writer.Push(depth+1, ListItemPrefix+encodePrimitive(item, opts.Delimiter))
-				} else if itemArr, ok := item.([]interface{}); ok && isArrayOfPrimitives(itemArr) {
-					inline := formatInlineArray(itemArr, opts.Delimiter, "", opts.LengthMarker)
-					writer.Push(depth+1, ListItemPrefix+inline)
-				} else if itemObj, ok := item.(map[string]interface{}); ok {
-					encodeObjectAsListItem(itemObj, writer, depth+1, opts)
-				}
-			}
-		}
-	} else if nestedObj, ok := firstValue.(map[string]interface{}); ok {
-		nestedKeys := make([]string, 0, len(nestedObj))
-		for k := range nestedObj {
-			nestedKeys = append(nestedKeys, k)
+			encodeListItems(arr, writer, depth+1, opts)
 		}
-
-		if len(nestedKeys) == 0 {
+	} else if nestedObj, ok := firstValue.(*object); ok {
+		if nestedObj.len() == 0 {
 			writer.Push(depth, ListItemPrefix+encodedKey+Colon)
 		} else {
 			writer.Push(depth, ListItemPrefix+encodedKey+Colon)
@@ -323,7 +445,7 @@ func encodeObjectAsListItem(obj map[string]interface{}, writer *LineWriter, dept
 
 	// Remaining keys on indented lines
 	for i := 1; i < len(keys); i++ {
-		key := keys[i]
-		encodeKeyValuePair(key, obj[key], writer, depth+1, opts)
+		encodedKey, value := foldKey(obj, keys[i], opts)
+		encodeKeyValuePair(encodedKey, value, writer, depth+1, opts)
 	}
 }
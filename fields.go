@@ -0,0 +1,408 @@
+package gotoon
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// field describes how an exported struct field is encoded and decoded
+type field struct {
+	name  string
+	index []int
+
+	// tagged is set when the name comes from a json or toon tag
+	tagged bool
+
+	// omitEmpty drops false, 0, nil and empty values (json "omitempty")
+	omitEmpty bool
+
+	// omitZero drops zero values or those whose IsZero reports true
+	// (json "omitzero")
+	omitZero bool
+
+	// asString encodes a bool, number or string as a string (json "string")
+	asString bool
+
+	// quote always quotes string values (toon "quote")
+	quote bool
+
+	// list encodes an array in list format instead of tabular (toon "list")
+	list bool
+
+	// header is the column name used in tabular arrays (toon "header=")
+	header string
+}
+
+// tagOptions is the comma-separated option list of a struct tag
+type tagOptions string
+
+// parseTag splits a struct tag into its name and options
+func parseTag(tag string) (string, tagOptions) {
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, tagOptions(opts)
+}
+
+// Contains reports whether the option list includes the given option
+func (o tagOptions) Contains(option string) bool {
+	for _, current := range strings.Split(string(o), ",") {
+		if current == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the value of a "key=value" option
+func (o tagOptions) Value(key string) (string, bool) {
+	for _, current := range strings.Split(string(o), ",") {
+		if value, ok := strings.CutPrefix(current, key+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// fieldCache maps each struct type to its fields
+var fieldCache sync.Map
+
+// cachedTypeFields is like typeFields but caches the result per type, so
+// tags are parsed only once
+func cachedTypeFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
+// typeFields returns the encodable fields of a struct type in declaration
+// order, following the encoding/json rules for the json tag:
+//   - `json:"-"` skips the field, `json:"-,"` names it "-"
+//   - an empty name keeps the Go field name
+//   - omitempty, omitzero and string options are honoured
+//   - fields of embedded structs without a tag name are promoted to the
+//     outer struct; when several fields share a name, the shallowest one
+//     wins, then the tagged one, and the name is dropped if that is still
+//     ambiguous
+//
+// A toon tag takes precedence over the json tag. Its name replaces the json
+// name, `toon:"-"` skips the field only in TOON, and it accepts the json
+// options plus the TOON-specific quote, list and header=<name> options.
+func typeFields(t reflect.Type) []field {
+	// Embedded structs are walked breadth first, one depth at a time
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var current []embedded
+	next := []embedded{{typ: t}}
+
+	// Number of times each struct type appears at the current and next
+	// depth; a type embedded twice at the same depth cancels its fields
+	var count map[reflect.Type]int
+	nextCount := map[reflect.Type]int{}
+
+	// Types already walked at a shallower depth
+	visited := map[reflect.Type]bool{}
+
+	var fields []field
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					// Unexported embedded structs still promote their
+					// exported fields
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+
+				f, ok := newField(sf)
+				if !ok {
+					continue
+				}
+				f.index = make([]int, len(e.index)+1)
+				copy(f.index, e.index)
+				f.index[len(e.index)] = i
+
+				if f.tagged || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					fields = append(fields, f)
+					if count[e.typ] > 1 {
+						// Add a duplicate so the conflict below drops it
+						fields = append(fields, f)
+					}
+					continue
+				}
+
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, embedded{typ: ft, index: f.index})
+				}
+			}
+		}
+	}
+
+	// Resolve fields that share a name
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		return a.tagged && !b.tagged
+	})
+	resolved := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if dominant, ok := dominantField(fields[i:j]); ok {
+			resolved = append(resolved, dominant)
+		}
+		i = j
+	}
+
+	// Restore declaration order
+	sort.Slice(resolved, func(i, j int) bool {
+		return slices.Compare(resolved[i].index, resolved[j].index) < 0
+	})
+	return resolved
+}
+
+// newField builds a field from its json and toon tags, reporting ok=false
+// if the field is skipped. The index is filled in by the caller.
+func newField(sf reflect.StructField) (field, bool) {
+	toonTag, hasToon := sf.Tag.Lookup("toon")
+	jsonTag := sf.Tag.Get("json")
+	if toonTag == "-" || (!hasToon && jsonTag == "-") {
+		return field{}, false
+	}
+	if jsonTag == "-" {
+		jsonTag = ""
+	}
+
+	toonName, toonOpts := parseTag(toonTag)
+	jsonName, jsonOpts := parseTag(jsonTag)
+	name := toonName
+	if name == "" {
+		name = jsonName
+	}
+	tagged := name != ""
+	if name == "" {
+		name = sf.Name
+	}
+
+	hasOption := func(option string) bool {
+		return toonOpts.Contains(option) || jsonOpts.Contains(option)
+	}
+
+	f := field{
+		name:      name,
+		tagged:    tagged,
+		omitEmpty: hasOption("omitempty"),
+		omitZero:  hasOption("omitzero"),
+		quote:     toonOpts.Contains("quote"),
+		list:      toonOpts.Contains("list"),
+	}
+	f.header, _ = toonOpts.Value("header")
+	if hasOption("string") {
+		ft := sf.Type
+		if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64,
+			reflect.String:
+			f.asString = true
+		}
+	}
+	return f, true
+}
+
+// dominantField picks the field that wins among fields sharing a name,
+// sorted by depth and then tagged first. It reports ok=false when the two
+// best candidates are equally shallow and equally tagged.
+func dominantField(fields []field) (field, bool) {
+	if len(fields) > 1 && len(fields[0].index) == len(fields[1].index) && fields[0].tagged == fields[1].tagged {
+		return field{}, false
+	}
+	return fields[0], true
+}
+
+// fieldByIndex returns the struct field at index, reporting ok=false when
+// the path passes through a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc returns the struct field at index, allocating nil
+// embedded pointers along the way
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("toon: cannot set embedded pointer to unexported struct: %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// lookupField finds the field for a key or tabular column header, preferring
+// an exact match and falling back to a case-insensitive one like
+// encoding/json
+func lookupField(fields []field, key string) (field, bool) {
+	fallback := -1
+	for i, f := range fields {
+		if f.name == key || (f.header != "" && f.header == key) {
+			return f, true
+		}
+		if fallback < 0 && strings.EqualFold(f.name, key) {
+			fallback = i
+		}
+	}
+	if fallback < 0 {
+		return field{}, false
+	}
+	return fields[fallback], true
+}
+
+// omit reports whether a field value is dropped by omitempty or omitzero
+func (f field) omit(v reflect.Value) bool {
+	return (f.omitEmpty && isEmptyValue(v)) || (f.omitZero && isZeroValue(v))
+}
+
+// applyOptions applies the quote and list options to a normalized value
+func (f field) applyOptions(value interface{}) interface{} {
+	if f.quote {
+		value = quoteStrings(value)
+	}
+	if arr, ok := value.([]interface{}); ok && f.list {
+		return listArray(arr)
+	}
+	return value
+}
+
+// quoteStrings marks a string, or the strings of an array, as always quoted
+func quoteStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return quotedString(v)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = quoteStrings(item)
+		}
+	}
+	return value
+}
+
+// isEmptyValue reports whether v is empty in the omitempty sense
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isZeroer is implemented by types that define their own zero value
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// isZeroValue reports whether v is zero in the omitzero sense
+func isZeroValue(v reflect.Value) bool {
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return true
+	}
+	if v.Type().Implements(isZeroerType) {
+		return v.Interface().(isZeroer).IsZero()
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(isZeroerType) {
+		return v.Addr().Interface().(isZeroer).IsZero()
+	}
+	return v.IsZero()
+}
+
+// stringFieldValue returns the string form of a field tagged with the json
+// "string" option, matching encoding/json
+func (n *normalizer) stringFieldValue(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		normalized, err := n.normalize(v)
+		if f, ok := normalized.(float64); ok {
+			return formatNumber(f), err
+		}
+		return normalized, err
+	case reflect.String:
+		quoted, _ := json.Marshal(v.String())
+		return string(quoted), nil
+	}
+	return n.normalize(v)
+}
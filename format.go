@@ -0,0 +1,79 @@
+package gotoon
+
+import "encoding/json"
+
+// Format parses a TOON document and re-emits it in canonical form, with
+// the layout Encode would choose for the same data:
+//   - Indentation is two spaces per level, or the width set by WithIndent
+//   - Strings and keys are quoted only where needed, with canonical escapes
+//   - Arrays use one delimiter throughout, comma unless WithDelimiter says
+//     otherwise, and length markers only with WithLengthMarker
+//   - Arrays of uniform objects become tabular and primitive arrays inline
+//   - Numbers keep their digits, with exponents expanded unless that would
+//     take more than 400 digits
+//
+// Keys keep their order unless WithKeyOrder or WithKeyCompare is given, and
+// blank lines are dropped. Like Encode, Format writes dotted keys such as
+// "a.b" without quotes unless WithKeyFolding or WithNestedTabular is given,
+// so documents read with WithPathExpansion should be formatted with one of
+// them to keep such keys literal. The output ends with a newline unless it
+// is empty. Malformed input returns a *SyntaxError.
+//
+// Example:
+//
+//	formatted, err := gotoon.Format(src)
+func Format(data []byte, opts ...EncodeOption) ([]byte, error) {
+	options := resolveOptions(opts)
+
+	lines, err := splitLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{lines: lines, useNumber: true}
+	value, err := p.parseDocument()
+	if err != nil {
+		return nil, err
+	}
+	value = canonicalNumbers(value)
+
+	var output string
+	if options.truncates() {
+		result, err := truncateTree(value, options)
+		if err != nil {
+			return nil, err
+		}
+		output = result.Output
+	} else {
+		writer := NewLineWriter(options.Indent)
+		encodeValueTo(value, writer, options)
+		output = writer.String()
+	}
+
+	if output == "" {
+		return []byte{}, nil
+	}
+	return []byte(output + "\n"), nil
+}
+
+// canonicalNumbers expands the exponents of the numbers in a parsed tree,
+// as Encode does for json.Number values
+func canonicalNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *object:
+		for _, key := range v.keys {
+			v.values[key] = canonicalNumbers(v.values[key])
+		}
+
+	case []interface{}:
+		for i, item := range v {
+			v[i] = canonicalNumbers(item)
+		}
+
+	case json.Number:
+		if s, err := decimalString(string(v)); err == nil {
+			return json.Number(s)
+		}
+	}
+	return value
+}
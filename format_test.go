@@ -0,0 +1,84 @@
+package gotoon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     []EncodeOption
+		expected string
+	}{
+		{
+			name:     "indentation and quoting",
+			input:    "name:    \"Alice\"\nnested:\n    deep:   \"a b\"\n    n: \"123\"",
+			expected: "name: Alice\nnested:\n  deep: a b\n  n: \"123\"\n",
+		},
+		{
+			name:     "delimiters and length markers",
+			input:    "items[#2|]{id|name}:\n  1|\"A\"\n  2|B\ntags[3\t]: a\tb\tc",
+			expected: "items[2]{id,name}:\n  1,A\n  2,B\ntags[3]: a,b,c\n",
+		},
+		{
+			name:     "uniform list items become tabular",
+			input:    "users[2]:\n  - id: 1\n    name: A\n  - id: 2\n    name: B",
+			expected: "users[2]{id,name}:\n  1,A\n  2,B\n",
+		},
+		{
+			name:     "numbers",
+			input:    "[3]: 1e3,1.50,-2.5E-1",
+			expected: "[3]: 1000,1.50,-0.25\n",
+		},
+		{
+			name:     "long exponents are kept",
+			input:    "a: 1e999999",
+			expected: "a: 1e999999\n",
+		},
+		{
+			name:     "lists and blank lines",
+			input:    "[2]:\n\n  - [2]: 1,2\n  - x\n\n",
+			expected: "[2]:\n  - [2]: 1,2\n  - x\n",
+		},
+		{
+			name:     "options",
+			input:    "b: 1\na[2]: x,y",
+			opts:     []EncodeOption{WithIndent(4), WithDelimiter("|"), WithLengthMarker(), WithKeyOrder(KeyOrderAlphabetical)},
+			expected: "a[#2|]: x|y\nb: 1\n",
+		},
+		{
+			name:     "empty document",
+			input:    "\n\n",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Format([]byte(tt.input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("expected:\n%q\n\ngot:\n%q", tt.expected, result)
+			}
+
+			again, err := Format(result, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error formatting the output: %v", err)
+			}
+			if string(again) != string(result) {
+				t.Errorf("formatting is not idempotent:\n%q\n\nthen:\n%q", result, again)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		var syntaxErr *SyntaxError
+		if _, err := Format([]byte("items[3]: a,b")); !errors.As(err, &syntaxErr) {
+			t.Errorf("expected *SyntaxError, got %v", err)
+		}
+	})
+}
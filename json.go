@@ -0,0 +1,231 @@
+package gotoon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FromJSON converts a JSON document to TOON. Keys keep the order they have
+// in the document unless WithKeyOrder or WithKeyCompare says otherwise, and
+// numbers keep their exact decimal value.
+//
+// It accepts the same options as Encode. Malformed JSON returns the error
+// reported by encoding/json; documents nested deeper than the maximum depth
+// return an error as well.
+//
+// Example:
+//
+//	encoded, err := gotoon.FromJSON(body, gotoon.WithDelimiter("\t"))
+func FromJSON(data []byte, opts ...EncodeOption) (string, error) {
+	options := resolveOptions(opts)
+
+	value, err := parseJSON(data, options.MaxDepth)
+	if err != nil {
+		return "", err
+	}
+
+	if options.truncates() {
+		result, err := truncateTree(value, options)
+		if err != nil {
+			return "", err
+		}
+		return result.Output, nil
+	}
+
+	writer := NewLineWriter(options.Indent)
+	encodeValueTo(value, writer, options)
+	return writer.String(), nil
+}
+
+// ToJSON converts a TOON document to compact JSON. Keys keep the order they
+// have in the document and numbers are written exactly as they appear.
+//
+// It accepts the same options as Decode; malformed input returns a
+// *SyntaxError. Use json.Indent to format the result.
+//
+// Example:
+//
+//	compact, err := gotoon.ToJSON(data)
+func ToJSON(data []byte, opts ...DecodeOption) ([]byte, error) {
+	options := resolveDecodeOptions(opts)
+
+	lines, err := splitLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{lines: lines, useNumber: true, expandPaths: options.ExpandPaths}
+	value, err := p.parseDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeJSON(&buf, value)
+	return buf.Bytes(), nil
+}
+
+// parseJSON reads a JSON document into a normalized tree, keeping objects
+// in document order
+func parseJSON(data []byte, maxDepth int) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := readJSONValue(dec, 0, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("invalid character after top-level value")
+		}
+		return nil, fmt.Errorf("toon: %w", err)
+	}
+	return value, nil
+}
+
+// readJSONValue reads the next JSON value from dec. depth is the number of
+// arrays and objects enclosing it.
+func readJSONValue(dec *json.Decoder, depth, maxDepth int) (interface{}, error) {
+	token, err := dec.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("toon: %w", io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("toon: %w", err)
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		depth++
+		if maxDepth > 0 && depth > maxDepth {
+			return nil, fmt.Errorf("toon: JSON input exceeds maximum depth of %d", maxDepth)
+		}
+
+		if t == '[' {
+			items := []interface{}{}
+			for dec.More() {
+				item, err := readJSONValue(dec, depth, maxDepth)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, readJSONDelim(dec)
+		}
+
+		obj := newObject(0)
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("toon: %w", err)
+			}
+			item, err := readJSONValue(dec, depth, maxDepth)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(keyToken.(string), item)
+		}
+		return obj, readJSONDelim(dec)
+
+	case json.Number:
+		s, err := decimalString(string(t))
+		if err != nil {
+			return nil, fmt.Errorf("toon: %w", err)
+		}
+		return json.Number(s), nil
+	}
+
+	// Strings, booleans and null
+	return token, nil
+}
+
+// readJSONDelim reads the delimiter closing an array or object
+func readJSONDelim(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("toon: %w", err)
+	}
+	return nil
+}
+
+// writeJSON writes a parsed TOON value or a normalized tree as compact JSON
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case *object:
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			writeJSON(buf, v.values[key])
+		}
+		buf.WriteByte('}')
+
+	case []interface{}:
+		writeJSONArray(buf, v)
+
+	case listArray:
+		writeJSONArray(buf, v)
+
+	case string:
+		writeJSONString(buf, v)
+
+	case quotedString:
+		writeJSONString(buf, string(v))
+
+	case json.Number:
+		buf.WriteString(string(v))
+
+	case int64, uint64, float64:
+		buf.WriteString(encodePrimitive(v, ""))
+
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+
+	default:
+		buf.WriteString(NullLiteral)
+	}
+}
+
+// writeJSONArray writes an array as compact JSON
+func writeJSONArray(buf *bytes.Buffer, arr []interface{}) {
+	buf.WriteByte('[')
+	for i, item := range arr {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSON(buf, item)
+	}
+	buf.WriteByte(']')
+}
+
+// writeJSONString writes s as a JSON string. Unlike encoding/json it leaves
+// <, > and & unescaped, since the output is not meant for HTML. Invalid
+// UTF-8 is replaced with U+FFFD, as encoding/json does.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(buf, `\u%04x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
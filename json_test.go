@@ -0,0 +1,163 @@
+package gotoon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     []EncodeOption
+		expected string
+	}{
+		{
+			name:     "keys keep document order",
+			input:    `{"name":"Alice","id":1,"tags":["a","b"]}`,
+			expected: "name: Alice\nid: 1\ntags[2]: a,b",
+		},
+		{
+			name:     "alphabetical key order",
+			input:    `{"name":"Alice","id":1}`,
+			opts:     []EncodeOption{WithKeyOrder(KeyOrderAlphabetical)},
+			expected: "id: 1\nname: Alice",
+		},
+		{
+			name:     "exact numbers",
+			input:    `[12345678901234567890, 1.5e3, 0.10, -2]`,
+			expected: "[4]: 12345678901234567890,1500,0.10,-2",
+		},
+		{
+			name:     "tabular rows in column order",
+			input:    `{"users":[{"name":"Alice","id":1},{"id":2,"name":"Bob"}]}`,
+			opts:     []EncodeOption{WithDelimiter("|")},
+			expected: "users[2|]{name|id}:\n  Alice|1\n  Bob|2",
+		},
+		{
+			name:     "primitives",
+			input:    ` "hello, world" `,
+			expected: `"hello, world"`,
+		},
+		{
+			name:     "empty containers",
+			input:    `{"a":{},"b":[]}`,
+			expected: "a:\nb[0]:",
+		},
+		{
+			name:     "truncation",
+			input:    `{"ids":[1,2,3,4]}`,
+			opts:     []EncodeOption{WithMaxArrayItems(2)},
+			expected: "ids[2]: 1,2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FromJSON([]byte(tt.input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, input := range []string{``, `{"a":}`, `[1,2`, `{} {}`, `[1] x`, `{"a":1e999999}`, `[1e9999999]`} {
+			if _, err := FromJSON([]byte(input)); err == nil {
+				t.Errorf("%q: expected an error", input)
+			}
+		}
+
+		deep := strings.Repeat("[", 5) + strings.Repeat("]", 5)
+		if _, err := FromJSON([]byte(deep), WithMaxDepth(5)); err != nil {
+			t.Errorf("unexpected error at the limit: %v", err)
+		}
+		if _, err := FromJSON([]byte(deep), WithMaxDepth(4)); err == nil || !strings.Contains(err.Error(), "maximum depth") {
+			t.Errorf("expected a depth error, got %v", err)
+		}
+	})
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     []DecodeOption
+		expected string
+	}{
+		{
+			name:     "keys keep document order",
+			input:    "name: Alice\nid: 1\nactive: true\nnote: null",
+			expected: `{"name":"Alice","id":1,"active":true,"note":null}`,
+		},
+		{
+			name:     "tabular and list arrays",
+			input:    "users[2]{id,name}:\n  1,Alice\n  2,Bob\nitems[2]:\n  - a: 1\n  - [2]: x,y",
+			expected: `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"items":[{"a":1},["x","y"]]}`,
+		},
+		{
+			name:     "exact numbers",
+			input:    "[3]: 12345678901234567890,0.10,-2",
+			expected: `[12345678901234567890,0.10,-2]`,
+		},
+		{
+			name:     "escaped strings",
+			input:    `text: "a \"b\"\n<c> & d\\"`,
+			expected: `{"text":"a \"b\"\n<c> & d\\"}`,
+		},
+		{
+			name:     "control characters",
+			input:    "text: \"\x01\"",
+			expected: `{"text":"\u0001"}`,
+		},
+		{
+			name:     "path expansion",
+			input:    "a.b: 1\na.c: 2",
+			opts:     []DecodeOption{WithPathExpansion()},
+			expected: `{"a":{"b":1,"c":2}}`,
+		},
+		{
+			name:     "empty document",
+			input:    "",
+			expected: `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ToJSON([]byte(tt.input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		input := `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"meta":{"count":2,"tags":["x"]}}`
+		encoded, err := FromJSON([]byte(input))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		result, err := ToJSON([]byte(encoded))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(result) != input {
+			t.Errorf("expected %s, got %s", input, result)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var syntaxErr *SyntaxError
+		if _, err := ToJSON([]byte("items[3]: a,b")); !errors.As(err, &syntaxErr) {
+			t.Errorf("expected *SyntaxError, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package gotoon
+
+// ArrayFormat identifies how an array is laid out in TOON
+type ArrayFormat int
+
+const (
+	// ArrayInline is an array of primitives written on its header line,
+	// such as tags[2]: a,b, or an empty array
+	ArrayInline ArrayFormat = iota
+
+	// ArrayTabular is an array of objects written as rows under a
+	// {fields} header
+	ArrayTabular
+
+	// ArrayList is an array whose items are written as "- " lines
+	ArrayList
+)
+
+// String returns the name of the format
+func (f ArrayFormat) String() string {
+	switch f {
+	case ArrayInline:
+		return "inline"
+	case ArrayTabular:
+		return "tabular"
+	case ArrayList:
+		return "list"
+	}
+	return "unknown"
+}
+
+// ArrayLayout describes how one array of a value is encoded
+type ArrayLayout struct {
+	// Path locates the array, such as users or users[3].tags
+	Path string
+
+	// Format is the layout the encoder chose
+	Format ArrayFormat
+
+	// Length is the number of items
+	Length int
+
+	// Fields lists the columns of a tabular array
+	Fields []string
+}
+
+// ArrayLayouts reports how Encode lays out each array in v with the given
+// options, in document order. Arrays held in tabular cells are part of
+// their table and are not reported separately; truncation limits are not
+// applied.
+//
+// Example:
+//
+//	layouts, err := gotoon.ArrayLayouts(data)
+//	for _, l := range layouts {
+//		fmt.Printf("%s: %s, %d items\n", l.Path, l.Format, l.Length)
+//	}
+func ArrayLayouts(v interface{}, opts ...EncodeOption) ([]ArrayLayout, error) {
+	options := resolveOptions(opts)
+	normalized, err := normalizeValue(v, options)
+	if err != nil {
+		return nil, err
+	}
+	return describeArrays(normalized, options), nil
+}
+
+// JSONArrayLayouts is like ArrayLayouts for a JSON document, reporting how
+// FromJSON lays out its arrays
+func JSONArrayLayouts(data []byte, opts ...EncodeOption) ([]ArrayLayout, error) {
+	options := resolveOptions(opts)
+	value, err := parseJSON(data, options.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return describeArrays(value, options), nil
+}
+
+// describeArrays returns the layouts of the arrays in a normalized tree
+func describeArrays(value interface{}, opts *EncodeOptions) []ArrayLayout {
+	d := &arrayDescriber{opts: opts}
+	d.value(value, "")
+	return d.layouts
+}
+
+// arrayDescriber walks a normalized tree, recording the layout of each
+// array as the encoder chooses it
+type arrayDescriber struct {
+	opts    *EncodeOptions
+	layouts []ArrayLayout
+}
+
+// value describes the arrays in a value at the given path
+func (d *arrayDescriber) value(value interface{}, path string) {
+	switch v := value.(type) {
+	case *object:
+		for _, key := range v.orderedKeys(d.opts) {
+			d.value(v.values[key], keyPath(path, key))
+		}
+
+	case listArray:
+		d.layouts = append(d.layouts, ArrayLayout{Path: path, Format: ArrayList, Length: len(v)})
+		d.listItems(v, path)
+
+	case []interface{}:
+		if d.array(v, path, false) == ArrayList {
+			d.listItems(v, path)
+		}
+	}
+}
+
+// listItems describes the arrays in the items of a list array
+func (d *arrayDescriber) listItems(items []interface{}, path string) {
+	for i, item := range items {
+		itemPath := indexPath(path, i)
+		if arr, ok := item.([]interface{}); ok {
+			if d.array(arr, itemPath, true) == ArrayList {
+				d.listItems(arr, itemPath)
+			}
+			continue
+		}
+		d.value(item, itemPath)
+	}
+}
+
+// array records the layout of arr and returns its format, as chosen by
+// arrayFormat, or by listItemArrayFormat for arrays that are themselves list
+// items
+func (d *arrayDescriber) array(arr []interface{}, path string, listItem bool) ArrayFormat {
+	layout := ArrayLayout{Path: path, Length: len(arr)}
+	if listItem {
+		layout.Format = listItemArrayFormat(arr)
+	} else {
+		var table *tabularArray
+		layout.Format, table = arrayFormat(arr, d.opts)
+		if table != nil {
+			layout.Fields = columnNames(table.rows, table.header)
+		}
+	}
+
+	d.layouts = append(d.layouts, layout)
+	return layout.Format
+}
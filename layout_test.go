@@ -0,0 +1,180 @@
+package gotoon
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestArrayLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     []EncodeOption
+		expected []ArrayLayout
+	}{
+		{
+			name:  "tabular and inline",
+			input: `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"tags":["a","b"],"none":[]}`,
+			expected: []ArrayLayout{
+				{Path: "users", Format: ArrayTabular, Length: 2, Fields: []string{"id", "name"}},
+				{Path: "tags", Format: ArrayInline, Length: 2},
+				{Path: "none", Format: ArrayInline, Length: 0},
+			},
+		},
+		{
+			name:  "list items",
+			input: `{"items":[{"id":1,"tags":["x"]},{"id":2,"rows":[{"a":1}]}]}`,
+			expected: []ArrayLayout{
+				{Path: "items", Format: ArrayList, Length: 2},
+				{Path: "items[0].tags", Format: ArrayInline, Length: 1},
+				{Path: "items[1].rows", Format: ArrayTabular, Length: 1, Fields: []string{"a"}},
+			},
+		},
+		{
+			name:  "arrays in lists",
+			input: `[[1,2],[{"a":1},{"a":2}],"x"]`,
+			expected: []ArrayLayout{
+				{Path: "", Format: ArrayList, Length: 3},
+				{Path: "[0]", Format: ArrayInline, Length: 2},
+				{Path: "[1]", Format: ArrayList, Length: 2},
+			},
+		},
+		{
+			name:  "sparse rows",
+			input: `[{"a":1,"b":2},{"a":3}]`,
+			opts:  []EncodeOption{WithSparseTabular(SparseEmpty)},
+			expected: []ArrayLayout{
+				{Path: "", Format: ArrayTabular, Length: 2, Fields: []string{"a", "b"}},
+			},
+		},
+		{
+			name:  "nested tabular cells",
+			input: `{"rows":[{"id":1,"geo":{"lat":5},"tags":["x"]}]}`,
+			opts:  []EncodeOption{WithNestedTabular()},
+			expected: []ArrayLayout{
+				{Path: "rows", Format: ArrayTabular, Length: 1, Fields: []string{"id", "geo.lat", "tags"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layouts, err := JSONArrayLayouts([]byte(tt.input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(layouts, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, layouts)
+			}
+		})
+	}
+
+	t.Run("go values", func(t *testing.T) {
+		type Item struct {
+			Tags []string `toon:"tags,list"`
+		}
+		layouts, err := ArrayLayouts(map[string]interface{}{"items": []Item{{Tags: []string{"a"}}}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []ArrayLayout{
+			{Path: "items", Format: ArrayList, Length: 1},
+			{Path: "items[0].tags", Format: ArrayList, Length: 1},
+		}
+		if !reflect.DeepEqual(layouts, expected) {
+			t.Errorf("expected %+v, got %+v", expected, layouts)
+		}
+
+		if _, err := ArrayLayouts(map[string]interface{}{"f": func() {}}); err == nil {
+			t.Error("expected an error for an unsupported value")
+		}
+	})
+}
+
+func TestArrayLayoutsMatchEncode(t *testing.T) {
+	type Tagged struct {
+		ID   int      `toon:"id"`
+		Tags []string `toon:"tags,list"`
+	}
+	tests := []struct {
+		name  string
+		input interface{}
+		opts  []EncodeOption
+	}{
+		{
+			name:  "list option",
+			input: map[string]interface{}{"items": []Tagged{{ID: 1, Tags: []string{"a"}}}, "first": []interface{}{Tagged{Tags: []string{"b"}}}},
+		},
+		{
+			name: "nested tabular",
+			input: map[string]interface{}{
+				"rows":  []map[string]interface{}{{"id": 1, "geo": map[string]interface{}{"lat": 5}, "tags": []string{"x"}}},
+				"mixed": []map[string]interface{}{{"id": 1, "deep": []interface{}{map[string]interface{}{"a": 1}}}},
+			},
+			opts: []EncodeOption{WithNestedTabular()},
+		},
+		{
+			name: "sparse empty",
+			input: []interface{}{
+				map[string]interface{}{"rows": []map[string]interface{}{{"a": 1, "b": 2}, {"a": 3}}},
+				[]map[string]interface{}{{"a": 1}, {"b": 2}},
+			},
+			opts: []EncodeOption{WithSparseTabular(SparseEmpty)},
+		},
+		{
+			name: "sparse null",
+			input: map[string]interface{}{
+				"rows":  []map[string]interface{}{{"a": 1, "b": 2}, {"a": 3}},
+				"wide":  []map[string]interface{}{{"a": 1}, {"b": 2}, {"c": 3}},
+				"lists": [][]int{{1}, {2, 3}},
+			},
+			opts: []EncodeOption{WithSparseTabular(SparseNull), WithSparseThreshold(0.4)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Encode(tt.input, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			layouts, err := ArrayLayouts(tt.input, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Find the header of each array in document order and read its
+			// format back from the output
+			lines := strings.Split(encoded, "\n")
+			next := 0
+			for _, layout := range layouts {
+				key := layout.Path[strings.LastIndex(layout.Path, ".")+1:]
+				if strings.HasSuffix(key, "]") {
+					key = ""
+				}
+				header := regexp.MustCompile(`^ *(?:- )?` + regexp.QuoteMeta(key) + `\[#?(\d+)[^\]]*\](\{[^}]*\})?:(.*)$`)
+				for next < len(lines) && !header.MatchString(lines[next]) {
+					next++
+				}
+				if next == len(lines) {
+					t.Fatalf("%s: no header in output:\n%s", layout.Path, encoded)
+				}
+				match := header.FindStringSubmatch(lines[next])
+				next++
+
+				format := ArrayList
+				switch {
+				case match[2] != "":
+					format = ArrayTabular
+				case match[3] != "" || match[1] == "0":
+					format = ArrayInline
+				}
+				if format != layout.Format {
+					t.Errorf("%s: ArrayLayouts reports %s, Encode wrote %q", layout.Path, layout.Format, match[0])
+				}
+			}
+		})
+	}
+}
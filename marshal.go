@@ -0,0 +1,114 @@
+package gotoon
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+)
+
+// Marshaler is implemented by types that control their own TOON encoding.
+// MarshalTOON returns a value that is encoded in place of the receiver, such
+// as a string for identifiers or a map for composite values.
+type Marshaler interface {
+	MarshalTOON() (interface{}, error)
+}
+
+// MarshalerError wraps an error returned by a MarshalTOON, MarshalText or
+// MarshalJSON method
+type MarshalerError struct {
+	Type       reflect.Type
+	Err        error
+	sourceFunc string
+}
+
+// Error implements the error interface
+func (e *MarshalerError) Error() string {
+	return "toon: error calling " + e.sourceFunc + " for type " + e.Type.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *MarshalerError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// marshalerKind identifies the marshaling interface a type implements
+type marshalerKind int
+
+const (
+	noMarshaler marshalerKind = iota
+	toonMarshaler
+	textMarshaler
+	jsonMarshaler
+)
+
+// marshalerKindOf returns the preferred marshaling interface implemented by
+// t: Marshaler, then encoding.TextMarshaler, then json.Marshaler
+func marshalerKindOf(t reflect.Type) marshalerKind {
+	switch {
+	case t.Implements(marshalerType):
+		return toonMarshaler
+	case t.Implements(textMarshalerType):
+		return textMarshaler
+	case t.Implements(jsonMarshalerType):
+		return jsonMarshaler
+	}
+	return noMarshaler
+}
+
+// marshalerNormalizer normalizes values whose type implements the
+// marshaling interface for kind
+func marshalerNormalizer(kind marshalerKind) normalizerFunc {
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		return n.marshal(v.Interface(), kind, v.Type())
+	}
+}
+
+// addrMarshalerNormalizer normalizes addressable values whose pointer type
+// implements the marshaling interface for kind
+func addrMarshalerNormalizer(kind marshalerKind) normalizerFunc {
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		return n.marshal(v.Addr().Interface(), kind, v.Type())
+	}
+}
+
+// marshal normalizes a value through its own marshaling method. Marshaler
+// results are normalized in turn, encoding.TextMarshaler output is encoded
+// as a string and json.Marshaler output is decoded and normalized.
+func (n *normalizer) marshal(m interface{}, kind marshalerKind, t reflect.Type) (interface{}, error) {
+	switch kind {
+	case toonMarshaler:
+		value, err := m.(Marshaler).MarshalTOON()
+		if err != nil {
+			return nil, &MarshalerError{Type: t, Err: err, sourceFunc: "MarshalTOON"}
+		}
+		return n.normalizeInterface(value)
+
+	case textMarshaler:
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, &MarshalerError{Type: t, Err: err, sourceFunc: "MarshalText"}
+		}
+		return string(text), nil
+
+	case jsonMarshaler:
+		data, err := m.(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return nil, &MarshalerError{Type: t, Err: err, sourceFunc: "MarshalJSON"}
+		}
+		var value interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return nil, &MarshalerError{Type: t, Err: err, sourceFunc: "MarshalJSON"}
+		}
+		return n.normalizeInterface(value)
+	}
+	return nil, nil
+}
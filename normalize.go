@@ -1,102 +1,477 @@
 package gotoon
 
 import (
+	"encoding"
+	"encoding/json"
 	"math"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// UnsupportedTypeError is returned by Encode in strict mode when a value
+// has a type that cannot be represented in TOON, such as a channel, a
+// function or a map whose keys have no string form
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	Path string // path to the value, e.g. "users[1].callback"
+}
+
+// Error implements the error interface
+func (e *UnsupportedTypeError) Error() string {
+	if e.Path == "" {
+		return "toon: unsupported type: " + e.Type.String()
+	}
+	return "toon: unsupported type: " + e.Type.String() + " at " + e.Path
+}
+
+// UnsupportedValueError is returned by Encode in strict mode when a value
+// cannot be represented in TOON, such as NaN or an infinite float
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+	Path  string // path to the value, e.g. "stats.ratio"
+}
+
+// Error implements the error interface
+func (e *UnsupportedValueError) Error() string {
+	if e.Path == "" {
+		return "toon: unsupported value: " + e.Str
+	}
+	return "toon: unsupported value: " + e.Str + " at " + e.Path
+}
+
+// normalizer converts Go values to their normalized form
+type normalizer struct {
+	opts *EncodeOptions
+
+	// depth is the number of arrays and objects enclosing the current value
+	depth int
+
+	// visiting holds the pointers, maps and slices on the path to the
+	// current value, used to detect cycles
+	visiting map[visit]struct{}
+}
+
+// visit identifies a pointer, map or slice being normalized
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
 // normalizeValue converts any Go value to a JSON-compatible value
-func normalizeValue(value interface{}) interface{} {
+func normalizeValue(value interface{}, opts *EncodeOptions) (interface{}, error) {
+	n := &normalizer{opts: opts}
+	return n.normalizeInterface(value)
+}
+
+// normalizeInterface normalizes a value held in an interface, such as the
+// input to Encode or the result of a marshaler method
+func (n *normalizer) normalizeInterface(value interface{}) (interface{}, error) {
 	if value == nil {
-		return nil
+		return nil, nil
 	}
+	return n.normalize(reflect.ValueOf(value))
+}
 
-	v := reflect.ValueOf(value)
+// normalize converts a reflected Go value to a JSON-compatible value.
+// Working on reflect.Value keeps struct fields addressable, so marshaler
+// methods with pointer receivers are found.
+func (n *normalizer) normalize(v reflect.Value) (interface{}, error) {
+	return n.normalizeWith(typeNormalizer(v.Type()), v)
+}
 
-	switch v.Kind() {
-	case reflect.Bool:
-		return v.Bool()
+// normalizeWith normalizes v with the normalizerFunc compiled for its type
+func (n *normalizer) normalizeWith(f normalizerFunc, v reflect.Value) (interface{}, error) {
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
 
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return float64(v.Int())
+	// Track nesting for the depth limit and cycle detection
+	if err := n.enter(v); err != nil {
+		return nil, err
+	}
+	defer n.leave(v)
 
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return float64(v.Uint())
+	return f(n, v)
+}
 
-	case reflect.Float32, reflect.Float64:
-		f := v.Float()
-		// Handle special float values
-		if math.IsNaN(f) || math.IsInf(f, 0) {
-			return nil
-		}
-		// Normalize -0 to 0
-		if f == 0 {
-			return 0.0
+// normalizerFunc normalizes a non-nil value of one particular type
+type normalizerFunc func(n *normalizer, v reflect.Value) (interface{}, error)
+
+// normalizerCache maps each reflect.Type to its compiled normalizerFunc, so
+// the type's fields, tags and marshaler methods are inspected only once
+var normalizerCache sync.Map
+
+// typeNormalizer returns the normalizerFunc for a type, compiling and
+// caching it on first use
+func typeNormalizer(t reflect.Type) normalizerFunc {
+	if f, ok := normalizerCache.Load(t); ok {
+		return f.(normalizerFunc)
+	}
+
+	// Recursive types refer back to themselves while being compiled. Store
+	// an indirect func that waits for the real one so they resolve to it.
+	var (
+		wg sync.WaitGroup
+		f  normalizerFunc
+	)
+	wg.Add(1)
+	fi, loaded := normalizerCache.LoadOrStore(t, normalizerFunc(func(n *normalizer, v reflect.Value) (interface{}, error) {
+		wg.Wait()
+		return f(n, v)
+	}))
+	if loaded {
+		return fi.(normalizerFunc)
+	}
+
+	f = newTypeNormalizer(t, true)
+	wg.Done()
+	normalizerCache.Store(t, f)
+	return f
+}
+
+// newTypeNormalizer compiles the normalizerFunc for a type. When allowAddr
+// is set, marshaler methods with pointer receivers are used for addressable
+// values.
+func newTypeNormalizer(t reflect.Type, allowAddr bool) normalizerFunc {
+	// Handle time.Time specially
+	if t == timeType {
+		return normalizeTime
+	}
+
+	// Numbers that must keep their exact value
+	if isNumberType(t) {
+		return normalizeNumber
+	}
+
+	// Types may control their own encoding
+	if allowAddr && t.Kind() != reflect.Ptr {
+		if addrKind := marshalerKindOf(reflect.PointerTo(t)); addrKind != marshalerKindOf(t) {
+			return condAddrNormalizer(addrMarshalerNormalizer(addrKind), newTypeNormalizer(t, false))
 		}
-		return f
+	}
+	if kind := marshalerKindOf(t); kind != noMarshaler {
+		return marshalerNormalizer(kind)
+	}
 
+	switch t.Kind() {
+	case reflect.Bool:
+		return normalizeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return normalizeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return normalizeUint
+	case reflect.Float32, reflect.Float64:
+		return normalizeFloat
 	case reflect.String:
-		return v.String()
-
+		return normalizeString
 	case reflect.Slice, reflect.Array:
-		arr := make([]interface{}, v.Len())
-		for i := 0; i < v.Len(); i++ {
-			arr[i] = normalizeValue(v.Index(i).Interface())
+		return newArrayNormalizer(t)
+	case reflect.Map:
+		return newMapNormalizer(t)
+	case reflect.Struct:
+		return newStructNormalizer(t)
+	case reflect.Ptr:
+		return newPtrNormalizer(t)
+	case reflect.Interface:
+		return normalizeInterfaceValue
+	default:
+		// Functions, channels, complex numbers and unsafe pointers
+		return normalizeUnsupported
+	}
+}
+
+func normalizeTime(n *normalizer, v reflect.Value) (interface{}, error) {
+	return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+}
+
+func normalizeBool(n *normalizer, v reflect.Value) (interface{}, error) {
+	return v.Bool(), nil
+}
+
+func normalizeInt(n *normalizer, v reflect.Value) (interface{}, error) {
+	return v.Int(), nil
+}
+
+func normalizeUint(n *normalizer, v reflect.Value) (interface{}, error) {
+	return v.Uint(), nil
+}
+
+func normalizeFloat(n *normalizer, v reflect.Value) (interface{}, error) {
+	f := v.Float()
+	// Handle special float values
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return n.unsupportedValue(v, strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	// Normalize -0 to 0
+	if f == 0 {
+		return 0.0, nil
+	}
+	return f, nil
+}
+
+func normalizeString(n *normalizer, v reflect.Value) (interface{}, error) {
+	return v.String(), nil
+}
+
+func normalizeInterfaceValue(n *normalizer, v reflect.Value) (interface{}, error) {
+	return n.normalize(v.Elem())
+}
+
+func normalizeUnsupported(n *normalizer, v reflect.Value) (interface{}, error) {
+	return n.unsupportedType(v)
+}
+
+// condAddrNormalizer uses addrFunc for addressable values and elseFunc
+// otherwise
+func condAddrNormalizer(addrFunc, elseFunc normalizerFunc) normalizerFunc {
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		if v.CanAddr() {
+			return addrFunc(n, v)
 		}
-		return arr
+		return elseFunc(n, v)
+	}
+}
 
-	case reflect.Map:
-		if v.Type().Key().Kind() != reflect.String {
-			// Non-string keys not supported, return null
-			return nil
+// newPtrNormalizer normalizes the value a pointer points to
+func newPtrNormalizer(t reflect.Type) normalizerFunc {
+	elemFunc := typeNormalizer(t.Elem())
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		return n.normalizeWith(elemFunc, v.Elem())
+	}
+}
+
+// newArrayNormalizer normalizes slices and arrays to []interface{}
+func newArrayNormalizer(t reflect.Type) normalizerFunc {
+	elemFunc := typeNormalizer(t.Elem())
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		arr := make([]interface{}, v.Len())
+		for i := range arr {
+			item, err := n.normalizeWith(elemFunc, v.Index(i))
+			if err != nil {
+				return nil, prefixPath(err, indexPath("", i))
+			}
+			arr[i] = item
 		}
-		obj := make(map[string]interface{})
+		return arr, nil
+	}
+}
+
+// newMapNormalizer normalizes maps to objects with keys sorted by their
+// string form, as encoding/json does
+func newMapNormalizer(t reflect.Type) normalizerFunc {
+	if !isValidMapKey(t.Key()) {
+		// Keys without a string form are not supported
+		return normalizeUnsupported
+	}
+	elemFunc := typeNormalizer(t.Elem())
+
+	type mapEntry struct {
+		key   string
+		value reflect.Value
+	}
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		entries := make([]mapEntry, 0, v.Len())
 		iter := v.MapRange()
 		for iter.Next() {
-			key := iter.Key().String()
-			obj[key] = normalizeValue(iter.Value().Interface())
+			key, err := mapKeyString(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, mapEntry{key: key, value: iter.Value()})
 		}
-		return obj
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
 
-	case reflect.Struct:
-		// Handle time.Time specially
-		if t, ok := value.(time.Time); ok {
-			return t.Format(time.RFC3339Nano)
+		obj := newObject(len(entries))
+		for _, entry := range entries {
+			value, err := n.normalizeWith(elemFunc, entry.value)
+			if err != nil {
+				return nil, prefixPath(err, entry.key)
+			}
+			obj.set(entry.key, value)
 		}
+		return obj, nil
+	}
+}
+
+// newStructNormalizer normalizes structs to objects using their exported
+// fields
+func newStructNormalizer(t reflect.Type) normalizerFunc {
+	fields := cachedTypeFields(t)
+	funcs := make([]normalizerFunc, len(fields))
+	for i, f := range fields {
+		funcs[i] = typeNormalizer(t.FieldByIndex(f.index).Type)
+	}
 
-		// Convert struct to map using exported fields
-		obj := make(map[string]interface{})
-		t := v.Type()
-		for i := 0; i < v.NumField(); i++ {
-			field := t.Field(i)
-			// Only include exported fields
-			if field.PkgPath == "" {
-				fieldValue := v.Field(i)
-				if fieldValue.CanInterface() {
-					// Use json tag if available, otherwise use field name
-					name := field.Name
-					if tag := field.Tag.Get("json"); tag != "" && tag != "-" {
-						name = tag
-					}
-					obj[name] = normalizeValue(fieldValue.Interface())
-				}
+	return func(n *normalizer, v reflect.Value) (interface{}, error) {
+		obj := newObject(len(fields))
+		for i, f := range fields {
+			fieldValue, ok := fieldByIndex(v, f.index)
+			if !ok || f.omit(fieldValue) {
+				continue
+			}
+			var normalized interface{}
+			var err error
+			if f.asString {
+				normalized, err = n.stringFieldValue(fieldValue)
+			} else {
+				normalized, err = n.normalizeWith(funcs[i], fieldValue)
+			}
+			if err != nil {
+				return nil, prefixPath(err, f.name)
+			}
+			obj.set(f.name, f.applyOptions(normalized))
+			if f.header != "" {
+				obj.setHeader(f.name, f.header)
 			}
 		}
-		return obj
+		return obj, nil
+	}
+}
+
+// prefixPath prepends a key or index to the path of an error returned for a
+// nested value. Paths are built this way, on the way out, so that no path
+// strings are allocated unless an error occurs.
+func prefixPath(err error, prefix string) error {
+	switch e := err.(type) {
+	case *UnsupportedTypeError:
+		e.Path = joinPath(prefix, e.Path)
+	case *UnsupportedValueError:
+		e.Path = joinPath(prefix, e.Path)
+	}
+	return err
+}
+
+// joinPath joins a path prefix and the remaining path of a nested value
+func joinPath(prefix, path string) string {
+	if path == "" {
+		return prefix
+	}
+	if strings.HasPrefix(path, OpenBracket) {
+		return prefix + path
+	}
+	return prefix + "." + path
+}
 
-	case reflect.Ptr, reflect.Interface:
-		if v.IsNil() {
-			return nil
+// enter records that normalization is entering v. It returns an
+// *UnsupportedValueError when v is an array or object nested deeper than
+// the maximum depth, or a pointer, map or slice that is already being
+// normalized further up the path.
+func (n *normalizer) enter(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		n.depth++
+		if n.opts.MaxDepth > 0 && n.depth > n.opts.MaxDepth {
+			return &UnsupportedValueError{Value: v, Str: "exceeds maximum depth of " + strconv.Itoa(n.opts.MaxDepth)}
 		}
-		return normalizeValue(v.Elem().Interface())
+	}
 
-	default:
-		// Unsupported types (func, chan, etc.) become null
+	key, ok := visitKey(v)
+	if !ok {
 		return nil
 	}
+	if _, seen := n.visiting[key]; seen {
+		return &UnsupportedValueError{Value: v, Str: "encountered a cycle via " + v.Type().String()}
+	}
+	if n.visiting == nil {
+		n.visiting = make(map[visit]struct{})
+	}
+	n.visiting[key] = struct{}{}
+	return nil
+}
+
+// leave undoes enter once v has been normalized
+func (n *normalizer) leave(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		n.depth--
+	}
+	if key, ok := visitKey(v); ok {
+		delete(n.visiting, key)
+	}
 }
 
+// visitKey returns the key identifying a pointer, map or slice for cycle
+// detection, reporting ok=false for other values
+func visitKey(v reflect.Value) (visit, bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if !v.IsNil() {
+			return visit{ptr: v.Pointer(), typ: v.Type()}, true
+		}
+	case reflect.Slice:
+		if v.Len() > 0 {
+			return visit{ptr: v.Pointer(), typ: v.Type(), len: v.Len()}, true
+		}
+	}
+	return visit{}, false
+}
+
+// isValidMapKey reports whether map keys of type t have a string form: string
+// and integer kinds, and types implementing encoding.TextMarshaler
+func isValidMapKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return t.Implements(textMarshalerType)
+}
+
+// mapKeyString returns the string form of a map key, following the same
+// rules as encoding/json: string keys are used directly, then
+// encoding.TextMarshaler, then integers in decimal
+func mapKeyString(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		text, err := tm.MarshalText()
+		if err != nil {
+			return "", &MarshalerError{Type: k.Type(), Err: err, sourceFunc: "MarshalText"}
+		}
+		return string(text), nil
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", &UnsupportedTypeError{Type: k.Type()}
+}
+
+// unsupportedType reports a value of an unsupported type, which becomes
+// null unless strict mode is enabled
+func (n *normalizer) unsupportedType(v reflect.Value) (interface{}, error) {
+	if !n.opts.Strict {
+		return nil, nil
+	}
+	return nil, &UnsupportedTypeError{Type: v.Type()}
+}
+
+// unsupportedValue reports an unsupported value, which becomes null unless
+// strict mode is enabled
+func (n *normalizer) unsupportedValue(v reflect.Value, str string) (interface{}, error) {
+	if !n.opts.Strict {
+		return nil, nil
+	}
+	return nil, &UnsupportedValueError{Value: v, Str: str}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
 // Type guard functions
 
 // isPrimitive checks if a value is a JSON primitive (string, number, bool, null)
@@ -105,7 +480,7 @@ func isPrimitive(value interface{}) bool {
 		return true
 	}
 	switch value.(type) {
-	case bool, float64, string:
+	case bool, int64, uint64, float64, json.Number, string, quotedString:
 		return true
 	default:
 		return false
@@ -121,12 +496,12 @@ func isArray(value interface{}) bool {
 	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
 }
 
-// isObject checks if a value is a map (after normalization)
+// isObject checks if a value is an object (after normalization)
 func isObject(value interface{}) bool {
 	if value == nil {
 		return false
 	}
-	_, ok := value.(map[string]interface{})
+	_, ok := value.(*object)
 	return ok
 }
 
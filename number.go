@@ -0,0 +1,160 @@
+package gotoon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	numberType   = reflect.TypeOf(json.Number(""))
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+	bigRatType   = reflect.TypeOf(big.Rat{})
+)
+
+// maxDecimalDigits bounds the length of a number whose exponent is
+// expanded. It covers every float64, while keeping a short literal such as
+// 1e999999 from expanding into megabytes of digits.
+const maxDecimalDigits = 400
+
+// isNumberType reports whether t is json.Number or a math/big number type,
+// which are encoded as exact decimals
+func isNumberType(t reflect.Type) bool {
+	switch t {
+	case numberType,
+		bigIntType, bigFloatType, bigRatType,
+		reflect.PointerTo(bigIntType), reflect.PointerTo(bigFloatType), reflect.PointerTo(bigRatType):
+		return true
+	}
+	return false
+}
+
+// normalizeNumber normalizes json.Number and math/big values to a
+// json.Number holding their exact decimal form
+func normalizeNumber(n *normalizer, v reflect.Value) (interface{}, error) {
+	if v.Type() == numberType {
+		s := v.String()
+		if s == "" {
+			// The zero value, which encoding/json writes as 0
+			s = "0"
+		}
+		s, err := decimalString(s)
+		if err != nil {
+			return n.unsupportedValue(v, err.Error())
+		}
+		// Normalize -0 to 0, as for floats
+		if s[0] == '-' && strings.Trim(s, "-0.") == "" {
+			s = "0"
+		}
+		return json.Number(s), nil
+	}
+
+	switch x := bigValue(v).(type) {
+	case *big.Int:
+		return json.Number(x.String()), nil
+
+	case *big.Float:
+		if x.IsInf() {
+			return n.unsupportedValue(v, x.String())
+		}
+		if x.Sign() == 0 {
+			return json.Number("0"), nil
+		}
+		// Expand the shortest exact form, within the same digit limit as
+		// json.Number
+		s, err := decimalString(x.Text('e', -1))
+		if err != nil {
+			return n.unsupportedValue(v, err.Error())
+		}
+		return json.Number(s), nil
+
+	case *big.Rat:
+		if s, ok := ratDecimal(x); ok {
+			return json.Number(s), nil
+		}
+		// The decimal expansion does not terminate, keep the exact fraction
+		return x.String(), nil
+	}
+
+	return nil, nil
+}
+
+// bigValue returns a pointer to the math/big number held in v
+func bigValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		return v.Interface()
+	}
+	if !v.CanAddr() {
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		v = copied
+	}
+	return v.Addr().Interface()
+}
+
+// decimalString returns the plain decimal form of a JSON number literal,
+// expanding any exponent. It fails if s is not a valid number or its
+// decimal form could be longer than maxDecimalDigits.
+func decimalString(s string) (string, error) {
+	if !decimalPattern.MatchString(s) {
+		return "", fmt.Errorf("invalid number %s", strconv.Quote(s))
+	}
+	e := strings.IndexAny(s, "eE")
+	if e < 0 {
+		return s, nil
+	}
+
+	// The decimal form needs at most the mantissa plus the exponent digits
+	exp, err := strconv.Atoi(s[e+1:])
+	if exp < 0 {
+		exp = -exp
+	}
+	if err != nil || e+exp > maxDecimalDigits {
+		return "", fmt.Errorf("number %s is longer than %d digits in decimal form", s, maxDecimalDigits)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return "", fmt.Errorf("invalid number %s", strconv.Quote(s))
+	}
+	// A decimal literal always has a terminating expansion
+	decimal, _ := ratDecimal(r)
+	return decimal, nil
+}
+
+// ratDecimal returns the exact decimal form of r, reporting ok=false when
+// its decimal expansion does not terminate
+func ratDecimal(r *big.Rat) (string, bool) {
+	if r.IsInt() {
+		return r.Num().String(), true
+	}
+
+	// A fraction in lowest terms terminates when its denominator has no
+	// prime factors other than 2 and 5; the number of digits needed is the
+	// larger of the two exponents
+	denom := new(big.Int).Set(r.Denom())
+	twos := denom.TrailingZeroBits()
+	denom.Rsh(denom, twos)
+
+	five := big.NewInt(5)
+	fives := uint(0)
+	quo, rem := new(big.Int), new(big.Int)
+	for {
+		quo.QuoRem(denom, five, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		denom.Set(quo)
+		fives++
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return "", false
+	}
+
+	digits := max(twos, fives)
+	return r.FloatString(int(digits)), true
+}
@@ -0,0 +1,89 @@
+package gotoon
+
+import (
+	"slices"
+	"sort"
+)
+
+// object is the normalized form of structs and maps. It keeps keys in the
+// order they were added (declaration order for structs, alphabetical for
+// maps) and carries field metadata from toon struct tags.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+
+	// headers maps keys to tabular column names that differ from the key
+	headers map[string]string
+}
+
+// newObject creates an empty object with room for size keys
+func newObject(size int) *object {
+	return &object{
+		keys:   make([]string, 0, size),
+		values: make(map[string]interface{}, size),
+	}
+}
+
+// set adds or replaces the value for a key
+func (o *object) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// get returns the value for a key
+func (o *object) get(key string) (interface{}, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+// len returns the number of keys
+func (o *object) len() int {
+	return len(o.keys)
+}
+
+// setHeader sets the tabular column name used for a key
+func (o *object) setHeader(key, header string) {
+	if o.headers == nil {
+		o.headers = make(map[string]string)
+	}
+	o.headers[key] = header
+}
+
+// header returns the tabular column name for a key
+func (o *object) header(key string) string {
+	if header, ok := o.headers[key]; ok {
+		return header
+	}
+	return key
+}
+
+// orderedKeys returns the keys in the order selected by the options
+func (o *object) orderedKeys(opts *EncodeOptions) []string {
+	if opts.KeyCompare == nil && opts.KeyOrder == KeyOrderDeclaration {
+		return o.keys
+	}
+
+	keys := make([]string, len(o.keys))
+	copy(keys, o.keys)
+	sortKeys(keys, opts)
+	return keys
+}
+
+// sortKeys sorts keys in place in the order selected by the options
+func sortKeys(keys []string, opts *EncodeOptions) {
+	if opts.KeyCompare != nil {
+		slices.SortStableFunc(keys, opts.KeyCompare)
+	} else if opts.KeyOrder == KeyOrderAlphabetical {
+		sort.Strings(keys)
+	}
+}
+
+// quotedString is a string that is always quoted when encoded, produced by
+// the toon "quote" tag option
+type quotedString string
+
+// listArray is an array that is always encoded in list format, produced by
+// the toon "list" tag option
+type listArray []interface{}
@@ -1,6 +1,7 @@
 package gotoon
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -20,25 +21,34 @@ func encodePrimitive(value interface{}, delimiter string) string {
 		}
 		return FalseLiteral
 
+	case int64:
+		return strconv.FormatInt(v, 10)
+
+	case uint64:
+		return strconv.FormatUint(v, 10)
+
 	case float64:
 		// Format number without scientific notation
 		return formatNumber(v)
 
+	case json.Number:
+		// Already in exact decimal form
+		return string(v)
+
 	case string:
 		return encodeStringLiteral(v, delimiter)
 
+	case quotedString:
+		return DoubleQuote + escapeString(string(v)) + DoubleQuote
+
 	default:
 		return NullLiteral
 	}
 }
 
-// formatNumber formats a float64 without scientific notation
+// formatNumber formats a float64 without scientific notation, using the
+// fewest digits that represent it exactly
 func formatNumber(f float64) string {
-	// Check if it's an integer
-	if f == float64(int64(f)) {
-		return strconv.FormatInt(int64(f), 10)
-	}
-	// Use decimal format with appropriate precision
 	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
@@ -129,6 +139,16 @@ func encodeKey(key string) string {
 	return DoubleQuote + escapeString(key) + DoubleQuote
 }
 
+// encodeLiteralKey encodes a key that is not a folded path. When the output
+// may hold dotted paths, a key containing a dot is quoted so that path
+// expansion keeps it whole.
+func encodeLiteralKey(key string, opts *EncodeOptions) string {
+	if opts.writesPaths() && strings.Contains(key, ".") {
+		return DoubleQuote + escapeString(key) + DoubleQuote
+	}
+	return encodeKey(key)
+}
+
 var validKeyPattern = regexp.MustCompile(`^[A-Za-z_][\w.]*$`)
 
 // isValidUnquotedKey checks if a key can be used without quotes
@@ -136,6 +156,22 @@ func isValidUnquotedKey(key string) bool {
 	return validKeyPattern.MatchString(key)
 }
 
+var identifierSegmentPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// isIdentifierSegment checks if a key can be a segment of a dotted key path
+func isIdentifierSegment(key string) bool {
+	return identifierSegmentPattern.MatchString(key)
+}
+
+// encodeCell encodes a tabular cell, writing an array of primitives as its
+// delimited values in brackets
+func encodeCell(value interface{}, delimiter string) string {
+	if arr, ok := value.([]interface{}); ok {
+		return OpenBracket + joinEncodedValues(arr, delimiter) + CloseBracket
+	}
+	return encodePrimitive(value, delimiter)
+}
+
 // joinEncodedValues joins multiple primitive values with a delimiter
 func joinEncodedValues(values []interface{}, delimiter string) string {
 	encoded := make([]string, len(values))
@@ -149,9 +185,7 @@ func joinEncodedValues(values []interface{}, delimiter string) string {
 func formatHeader(length int, options headerOptions) string {
 	var sb strings.Builder
 
-	if options.key != "" {
-		sb.WriteString(encodeKey(options.key))
-	}
+	sb.WriteString(options.key)
 
 	// Array length with optional marker
 	sb.WriteString(OpenBracket)
@@ -170,11 +204,7 @@ func formatHeader(length int, options headerOptions) string {
 	// Field list for tabular format
 	if len(options.fields) > 0 {
 		sb.WriteString(OpenBrace)
-		quotedFields := make([]string, len(options.fields))
-		for i, field := range options.fields {
-			quotedFields[i] = encodeKey(field)
-		}
-		sb.WriteString(strings.Join(quotedFields, options.delimiter))
+		sb.WriteString(strings.Join(options.fields, options.delimiter))
 		sb.WriteString(CloseBrace)
 	}
 
@@ -185,7 +215,10 @@ func formatHeader(length int, options headerOptions) string {
 
 // headerOptions holds options for formatting headers
 type headerOptions struct {
-	key          string
+	// key is the encoded key of the array, or empty for an array without one
+	key string
+
+	// fields are the encoded column names of a table
 	fields       []string
 	delimiter    string
 	lengthMarker bool
@@ -0,0 +1,496 @@
+package gotoon
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Encoder writes TOON documents to an output stream
+type Encoder struct {
+	w    io.Writer
+	opts *EncodeOptions
+}
+
+// NewEncoder returns a new Encoder that writes to w using the given options
+func NewEncoder(w io.Writer, opts ...EncodeOption) *Encoder {
+	return &Encoder{
+		w:    w,
+		opts: resolveOptions(opts),
+	}
+}
+
+// Encode writes the TOON encoding of v to the stream. Every line, including
+// the last, is terminated by a newline.
+//
+// Lines are written as they are produced rather than being joined into a
+// single string first, so the encoded document is never held in memory. If
+// an error is returned, part of the document may already have been written.
+// With WithTokenBudget, WithMaxArrayItems or WithMaxStringLen the document
+// is built in memory first and written only if it encodes successfully.
+func (e *Encoder) Encode(v interface{}) error {
+	if e.opts.truncates() {
+		// The whole document is needed to measure it against the limits
+		result, err := encodeWithResult(v, e.opts)
+		if err != nil || result.Output == "" {
+			return err
+		}
+		_, err = io.WriteString(e.w, result.Output+Newline)
+		return err
+	}
+
+	writer := NewStreamingLineWriter(e.w, e.opts.Indent)
+	if err := encodeDirect(v, writer, e.opts); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// EntryKind identifies the kind of Entry produced by a Decoder
+type EntryKind int
+
+const (
+	// ValueEntry is a primitive value at Path
+	ValueEntry EntryKind = iota
+
+	// ObjectEntry starts a nested object at Path. Its fields follow as
+	// separate entries; an object without fields is empty.
+	ObjectEntry
+
+	// ArrayEntry is an inline array of primitives at Path, held in Values
+	ArrayEntry
+
+	// TableEntry starts a tabular array at Path with the declared Length
+	// and Fields. Its rows follow as RowEntry entries.
+	TableEntry
+
+	// RowEntry is a single row of the enclosing tabular array. Path
+	// includes the row index and Values lines up with Fields, which omits
+	// any field left empty in a sparse row. Bracketed array cells appear as
+	// []interface{} values.
+	RowEntry
+
+	// ListEntry starts an expanded array at Path with the declared Length.
+	// Its items follow as entries whose paths include the item index.
+	ListEntry
+)
+
+// Entry is a single unit of data read by a Decoder
+type Entry struct {
+	Kind EntryKind
+
+	// Path locates the entry in the document, e.g. "users[3]" or "meta.page"
+	Path string
+
+	// Value holds the primitive of a ValueEntry
+	Value interface{}
+
+	// Values holds the items of an ArrayEntry or the cells of a RowEntry
+	Values []interface{}
+
+	// Fields holds the column names of a TableEntry or RowEntry
+	Fields []string
+
+	// Length is the declared length of an ArrayEntry, TableEntry or ListEntry
+	Length int
+}
+
+// frameKind identifies the structure a decodeFrame is reading
+type frameKind int
+
+const (
+	objectFrame frameKind = iota
+	tableFrame
+	listFrame
+)
+
+// decodeFrame tracks an open object or array while streaming
+type decodeFrame struct {
+	kind   frameKind
+	path   string
+	header fieldHeader
+	line   line
+
+	// minDepth is the shallowest depth that still belongs to the frame
+	minDepth int
+
+	// itemDepth is the depth of rows or list items once the first is seen
+	itemDepth int
+
+	count int
+}
+
+// Decoder reads a TOON document from an input stream one entry at a time,
+// so large tabular arrays can be processed row by row in constant memory
+type Decoder struct {
+	r           *bufio.Reader
+	useNumber   bool
+	expandPaths bool
+
+	tracker indentTracker
+	lineNum int
+	started bool
+	done    bool
+
+	frames  []decodeFrame
+	pending []Entry
+	entry   Entry
+	err     error
+}
+
+// NewDecoder returns a new Decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// UseNumber causes the Decoder to report numbers as json.Number instead of
+// float64, preserving their exact text
+func (d *Decoder) UseNumber() {
+	d.useNumber = true
+}
+
+// ExpandPaths causes Decode to split unquoted dotted keys into nested
+// objects, as WithPathExpansion does for Unmarshal. Entries returned by
+// Next are unaffected, since their paths are already dotted.
+func (d *Decoder) ExpandPaths() {
+	d.expandPaths = true
+}
+
+// Next advances to the next entry, which is then available through Entry.
+// It returns false at the end of the input or after an error; call Err to
+// tell them apart.
+//
+// Example:
+//
+//	dec := gotoon.NewDecoder(r)
+//	for dec.Next() {
+//		if e := dec.Entry(); e.Kind == gotoon.RowEntry {
+//			process(e.Fields, e.Values)
+//		}
+//	}
+//	if err := dec.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+func (d *Decoder) Next() bool {
+	for len(d.pending) == 0 {
+		if d.err != nil || d.done {
+			return false
+		}
+
+		l, ok, err := d.readLine()
+		if err != nil {
+			d.err = err
+			return false
+		}
+		if !ok {
+			d.err = d.closeFrames(0)
+			d.done = true
+			continue
+		}
+		if err := d.processLine(l); err != nil {
+			d.err = err
+			return false
+		}
+	}
+
+	d.entry = d.pending[0]
+	d.pending = d.pending[1:]
+	return true
+}
+
+// Entry returns the entry read by the most recent call to Next
+func (d *Decoder) Entry() Entry {
+	return d.entry
+}
+
+// Err returns the first error encountered while reading, if any
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Decode reads the rest of the input and stores it in the value pointed to
+// by v, following the same rules as Unmarshal. It consumes the whole
+// document, so it should not be mixed with Next.
+func (d *Decoder) Decode(v interface{}) error {
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	if d.expandPaths {
+		return Unmarshal(data, v, WithPathExpansion())
+	}
+	return Unmarshal(data, v)
+}
+
+// readLine returns the next non-blank line of input
+func (d *Decoder) readLine() (line, bool, error) {
+	for {
+		raw, err := d.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return line{}, false, err
+		}
+		if raw == "" && err == io.EOF {
+			return line{}, false, nil
+		}
+		d.lineNum++
+
+		indent, text, scanErr := scanLine(strings.TrimSuffix(raw, Newline))
+		if scanErr != nil {
+			return line{}, false, &SyntaxError{Line: d.lineNum, Msg: scanErr.Error()}
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		depth, depthErr := d.tracker.depth(indent)
+		if depthErr != nil {
+			return line{}, false, &SyntaxError{Line: d.lineNum, Msg: depthErr.Error()}
+		}
+		return line{num: d.lineNum, depth: depth, indent: indent, text: text}, true, nil
+	}
+}
+
+// emit queues an entry to be returned by Next
+func (d *Decoder) emit(e Entry) {
+	d.pending = append(d.pending, e)
+}
+
+// push opens a new frame
+func (d *Decoder) push(f decodeFrame) {
+	f.itemDepth = -1
+	d.frames = append(d.frames, f)
+}
+
+// closeFrames closes open frames until only keep remain, checking that
+// arrays received as many rows or items as their headers declared
+func (d *Decoder) closeFrames(keep int) error {
+	for len(d.frames) > keep {
+		f := d.frames[len(d.frames)-1]
+		d.frames = d.frames[:len(d.frames)-1]
+		switch f.kind {
+		case tableFrame:
+			if f.count != f.header.length {
+				return syntaxErrorf(f.line, "array declares %d rows, found %d", f.header.length, f.count)
+			}
+		case listFrame:
+			if f.count != f.header.length {
+				return syntaxErrorf(f.line, "array declares %d items, found %d", f.header.length, f.count)
+			}
+		}
+	}
+	return nil
+}
+
+// processLine hands a line to the innermost frame that accepts it
+func (d *Decoder) processLine(l line) error {
+	if !d.started {
+		d.started = true
+		return d.processFirstLine(l)
+	}
+
+	for len(d.frames) > 0 {
+		handled, err := d.processInFrame(&d.frames[len(d.frames)-1], l)
+		if err != nil || handled {
+			return err
+		}
+		if err := d.closeFrames(len(d.frames) - 1); err != nil {
+			return err
+		}
+	}
+	return syntaxErrorf(l, "unexpected content after root value")
+}
+
+// processFirstLine decides whether the document is an object, array or
+// primitive
+func (d *Decoder) processFirstLine(l line) error {
+	if l.depth != 0 {
+		return syntaxErrorf(l, "unexpected indentation")
+	}
+
+	h, ok, err := parseFieldHeader(l.text)
+	if err != nil {
+		return wrapSyntaxError(l, err)
+	}
+	if ok && h.keyless() {
+		return d.processArray(l, h, "")
+	}
+	if !ok {
+		value, err := decodePrimitive(l.text, d.useNumber)
+		if err != nil {
+			return wrapSyntaxError(l, err)
+		}
+		d.emit(Entry{Kind: ValueEntry, Value: value})
+		return nil
+	}
+
+	d.push(decodeFrame{kind: objectFrame, minDepth: 0})
+	return d.processLine(l)
+}
+
+// processInFrame processes a line within the given frame, reporting whether
+// the line belonged to it
+func (d *Decoder) processInFrame(f *decodeFrame, l line) (bool, error) {
+	if l.depth < f.minDepth {
+		return false, nil
+	}
+
+	switch f.kind {
+	case tableFrame:
+		if !isRowLine(l.text) {
+			return false, nil
+		}
+		if f.itemDepth < 0 {
+			f.itemDepth = l.depth
+		} else if l.depth != f.itemDepth {
+			return true, syntaxErrorf(l, "inconsistent row indentation")
+		}
+
+		tokens := splitCells(l.text, f.header.delimiter)
+		if len(tokens) != len(f.header.fields) {
+			return true, syntaxErrorf(l, "row has %d values, header declares %d fields", len(tokens), len(f.header.fields))
+		}
+		fields := f.header.fields
+		values := make([]interface{}, 0, len(tokens))
+		for i, token := range tokens {
+			if isEmptyCell(token) {
+				// Leave the absent field out of a sparse row
+				if len(fields) == len(tokens) {
+					fields = append([]string(nil), fields[:i]...)
+				}
+				continue
+			}
+			value, err := decodeCell(token, f.header.delimiter, d.useNumber)
+			if err != nil {
+				return true, wrapSyntaxError(l, err)
+			}
+			if len(fields) != len(tokens) {
+				fields = append(fields, f.header.fields[i])
+			}
+			values = append(values, value)
+		}
+		d.emit(Entry{Kind: RowEntry, Path: indexPath(f.path, f.count), Fields: fields, Values: values})
+		f.count++
+		return true, nil
+
+	case listFrame:
+		if !isListItem(l.text) {
+			return false, nil
+		}
+		if f.itemDepth < 0 {
+			f.itemDepth = l.depth
+		} else if l.depth != f.itemDepth {
+			return true, syntaxErrorf(l, "inconsistent list item indentation")
+		}
+		path := indexPath(f.path, f.count)
+		f.count++
+		return true, d.processListItem(l, path)
+
+	default:
+		if l.depth > f.minDepth {
+			return true, syntaxErrorf(l, "unexpected indentation")
+		}
+		if isListItem(l.text) {
+			return true, syntaxErrorf(l, "unexpected list item")
+		}
+		return true, d.processField(l, l.text, f.path, l.depth+1)
+	}
+}
+
+// processField processes a key line. childDepth is the depth at which the
+// fields of a nested object are expected.
+func (d *Decoder) processField(l line, text string, parent string, childDepth int) error {
+	h, ok, err := parseFieldHeader(text)
+	if err != nil {
+		return wrapSyntaxError(l, err)
+	}
+	if !ok {
+		return syntaxErrorf(l, "expected key")
+	}
+	if h.keyless() {
+		return syntaxErrorf(l, "missing key")
+	}
+	return d.processValue(l, h, keyPath(parent, h.key), childDepth)
+}
+
+// processValue processes the value introduced by a key line
+func (d *Decoder) processValue(l line, h fieldHeader, path string, childDepth int) error {
+	if h.isArray {
+		return d.processArray(l, h, path)
+	}
+
+	if h.rest != "" {
+		value, err := decodePrimitive(h.rest, d.useNumber)
+		if err != nil {
+			return wrapSyntaxError(l, err)
+		}
+		d.emit(Entry{Kind: ValueEntry, Path: path, Value: value})
+		return nil
+	}
+
+	d.emit(Entry{Kind: ObjectEntry, Path: path})
+	d.push(decodeFrame{kind: objectFrame, path: path, minDepth: childDepth})
+	return nil
+}
+
+// processArray processes an array header, opening a frame for its rows or
+// items unless the values are inline
+func (d *Decoder) processArray(l line, h fieldHeader, path string) error {
+	switch {
+	case h.rest != "":
+		if h.fields != nil {
+			return syntaxErrorf(l, "tabular header cannot have inline values")
+		}
+		tokens := splitDelimited(h.rest, h.delimiter)
+		if len(tokens) != h.length {
+			return syntaxErrorf(l, "array declares %d values, found %d", h.length, len(tokens))
+		}
+		values := make([]interface{}, len(tokens))
+		for i, token := range tokens {
+			value, err := decodePrimitive(token, d.useNumber)
+			if err != nil {
+				return wrapSyntaxError(l, err)
+			}
+			values[i] = value
+		}
+		d.emit(Entry{Kind: ArrayEntry, Path: path, Values: values, Length: h.length})
+
+	case h.fields != nil:
+		d.emit(Entry{Kind: TableEntry, Path: path, Fields: h.fields, Length: h.length})
+		d.push(decodeFrame{kind: tableFrame, path: path, header: h, line: l, minDepth: l.depth + 1})
+
+	default:
+		d.emit(Entry{Kind: ListEntry, Path: path, Length: h.length})
+		d.push(decodeFrame{kind: listFrame, path: path, header: h, line: l, minDepth: l.depth + 1})
+	}
+	return nil
+}
+
+// processListItem processes a single "- " line of an expanded array
+func (d *Decoder) processListItem(l line, path string) error {
+	content := strings.TrimPrefix(strings.TrimPrefix(l.text, ListItemMarker), Space)
+	if content == "" {
+		d.emit(Entry{Kind: ObjectEntry, Path: path})
+		return nil
+	}
+
+	h, ok, err := parseFieldHeader(content)
+	if err != nil {
+		return wrapSyntaxError(l, err)
+	}
+	if !ok {
+		value, err := decodePrimitive(content, d.useNumber)
+		if err != nil {
+			return wrapSyntaxError(l, err)
+		}
+		d.emit(Entry{Kind: ValueEntry, Path: path, Value: value})
+		return nil
+	}
+	if h.keyless() {
+		return d.processArray(l, h, path)
+	}
+
+	// The remaining fields of the object sit one level deeper; the first
+	// field's own nested content opens its frame on top of them
+	d.emit(Entry{Kind: ObjectEntry, Path: path})
+	d.push(decodeFrame{kind: objectFrame, path: path, minDepth: l.depth + 1})
+	return d.processValue(l, h, keyPath(path, h.key), l.depth+2)
+}
@@ -0,0 +1,210 @@
+package gotoon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	inputs := []interface{}{
+		"hello",
+		map[string]interface{}{
+			"users": []map[string]interface{}{
+				{"id": 1, "name": "Alice"},
+				{"id": 2, "name": "Bob"},
+			},
+			"meta": map[string]interface{}{"page": 1},
+		},
+		[]interface{}{1, "two", map[string]interface{}{"three": 3}},
+	}
+
+	for _, input := range inputs {
+		expected, err := Encode(input, WithIndent(4), WithDelimiter("|"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf, WithIndent(4), WithDelimiter("|")).Encode(input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if buf.String() != expected+"\n" {
+			t.Errorf("expected:\n%q\n\ngot:\n%q", expected+"\n", buf.String())
+		}
+	}
+}
+
+func TestEncoderMultipleValues(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, v := range []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{"b": 2}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if expected := "a: 1\nb: 2\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	err := NewEncoder(failingWriter{}).Encode(map[string]interface{}{"a": 1})
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("expected write error, got %v", err)
+	}
+}
+
+func TestDecoderEntries(t *testing.T) {
+	input := "meta:\n  page: 1\ntags[2]: a,b\nusers[2]{id,name}:\n  1,Alice\n  2,Bob\n" +
+		"items[2]:\n  - 5\n  - rows[1]{x}:\n    9\n    note: hi\nempty:"
+
+	expected := []Entry{
+		{Kind: ObjectEntry, Path: "meta"},
+		{Kind: ValueEntry, Path: "meta.page", Value: 1.0},
+		{Kind: ArrayEntry, Path: "tags", Values: []interface{}{"a", "b"}, Length: 2},
+		{Kind: TableEntry, Path: "users", Fields: []string{"id", "name"}, Length: 2},
+		{Kind: RowEntry, Path: "users[0]", Fields: []string{"id", "name"}, Values: []interface{}{1.0, "Alice"}},
+		{Kind: RowEntry, Path: "users[1]", Fields: []string{"id", "name"}, Values: []interface{}{2.0, "Bob"}},
+		{Kind: ListEntry, Path: "items", Length: 2},
+		{Kind: ValueEntry, Path: "items[0]", Value: 5.0},
+		{Kind: ObjectEntry, Path: "items[1]"},
+		{Kind: TableEntry, Path: "items[1].rows", Fields: []string{"x"}, Length: 1},
+		{Kind: RowEntry, Path: "items[1].rows[0]", Fields: []string{"x"}, Values: []interface{}{9.0}},
+		{Kind: ValueEntry, Path: "items[1].note", Value: "hi"},
+		{Kind: ObjectEntry, Path: "empty"},
+	}
+
+	dec := NewDecoder(strings.NewReader(input))
+	var entries []Entry
+	for dec.Next() {
+		entries = append(entries, dec.Entry())
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected:\n%#v\n\ngot:\n%#v", expected, entries)
+	}
+}
+
+func TestDecoderSparseRows(t *testing.T) {
+	input := "users[2]{id,name,role}:\n  1,,admin\n  2,Bob,"
+
+	expected := []Entry{
+		{Kind: TableEntry, Path: "users", Fields: []string{"id", "name", "role"}, Length: 2},
+		{Kind: RowEntry, Path: "users[0]", Fields: []string{"id", "role"}, Values: []interface{}{1.0, "admin"}},
+		{Kind: RowEntry, Path: "users[1]", Fields: []string{"id", "name"}, Values: []interface{}{2.0, "Bob"}},
+	}
+
+	dec := NewDecoder(strings.NewReader(input))
+	var entries []Entry
+	for dec.Next() {
+		entries = append(entries, dec.Entry())
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected:\n%#v\n\ngot:\n%#v", expected, entries)
+	}
+}
+
+func TestDecoderLargeTable(t *testing.T) {
+	const rows = 10000
+	pr, pw := io.Pipe()
+	go func() {
+		fmt.Fprintf(pw, "rows[%d]{id,name}:\n", rows)
+		for i := 0; i < rows; i++ {
+			fmt.Fprintf(pw, "  %d,user%d\n", i, i)
+		}
+		pw.Close()
+	}()
+
+	dec := NewDecoder(pr)
+	dec.UseNumber()
+	count := 0
+	for dec.Next() {
+		e := dec.Entry()
+		if e.Kind != RowEntry {
+			continue
+		}
+		if e.Values[0] != json.Number(strconv.Itoa(count)) {
+			t.Fatalf("unexpected row %v at %s", e.Values, e.Path)
+		}
+		count++
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != rows {
+		t.Errorf("expected %d rows, got %d", rows, count)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+	}{
+		{name: "missing rows", input: "rows[3]{x}:\n  1\n  2\nnext: 1", line: 1},
+		{name: "missing rows at end", input: "rows[3]{x}:\n  1", line: 1},
+		{name: "row field count", input: "rows[1]{x,y}:\n  1", line: 2},
+		{name: "content after root primitive", input: "hello\nworld", line: 2},
+		{name: "unexpected indentation", input: "a: 1\n  b: 2", line: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.input))
+			for dec.Next() {
+			}
+			var syntaxErr *SyntaxError
+			if !errors.As(dec.Err(), &syntaxErr) {
+				t.Fatalf("expected *SyntaxError, got %v", dec.Err())
+			}
+			if syntaxErr.Line != tt.line {
+				t.Errorf("expected error on line %d, got %v", tt.line, dec.Err())
+			}
+		})
+	}
+}
+
+func TestDecoderEmptyKeys(t *testing.T) {
+	var v interface{}
+	if err := NewDecoder(strings.NewReader("[1]:\n  - \"\": 1\n    \"\"[1]: x\n")).Decode(&v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []interface{}{map[string]interface{}{"": []interface{}{"x"}}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %#v, got %#v", expected, v)
+	}
+}
+
+func TestDecoderDecode(t *testing.T) {
+	var v struct {
+		Users []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"users"`
+	}
+	if err := NewDecoder(strings.NewReader("users[1]{id,name}:\n  7,Ada\n")).Decode(&v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(v.Users) != 1 || v.Users[0].ID != 7 || v.Users[0].Name != "Ada" {
+		t.Errorf("unexpected result: %+v", v)
+	}
+}
@@ -0,0 +1,144 @@
+package gotoon
+
+import (
+	"encoding/json"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a language model needs for a piece of text
+type Tokenizer interface {
+	CountTokens(s string) int
+}
+
+// DefaultTokenizer is the Tokenizer used by CountTokens and by encoding
+// functions that measure their output when no tokenizer is given with
+// WithTokenizer. It counts exactly with the embedded cl100k_base vocabulary
+// of CL100KBase, which is loaded the first time tokens are counted.
+var DefaultTokenizer Tokenizer = cl100kTokenizer{}
+
+// cl100kTokenizer counts tokens with CL100KBase, deferring the loading of
+// the vocabulary until it is needed
+type cl100kTokenizer struct{}
+
+// CountTokens returns the number of tokens s encodes to
+func (cl100kTokenizer) CountTokens(s string) int {
+	return CL100KBase().CountTokens(s)
+}
+
+// ApproxTokenizer estimates token counts offline, without a vocabulary. It
+// splits text with the same pre-tokenization rules as BPETokenizer and
+// charges each piece by its shape: short words, numbers of up to three
+// digits and whitespace runs cost one token, longer words and punctuation
+// runs cost more, and non-ASCII text costs roughly one token per character.
+//
+// The estimate is meant for comparing encodings of the same data without
+// loading a vocabulary. DefaultTokenizer gives exact cl100k_base counts.
+type ApproxTokenizer struct{}
+
+// CountTokens returns the estimated number of tokens in s
+func (ApproxTokenizer) CountTokens(s string) int {
+	count := 0
+	for _, piece := range splitPieces(s) {
+		count += approxPieceTokens(piece)
+	}
+	return count
+}
+
+// approxPieceTokens estimates the number of tokens for a single piece
+func approxPieceTokens(piece string) int {
+	letters, other, nonASCII := 0, 0, 0
+	for _, r := range piece {
+		switch {
+		case r >= utf8.RuneSelf:
+			nonASCII++
+		case unicode.IsLetter(r):
+			letters++
+		case !unicode.IsSpace(r) && !unicode.IsNumber(r):
+			other++
+		}
+	}
+
+	switch {
+	case nonASCII > 0:
+		return nonASCII + (letters+other+5)/6
+	case letters > 0:
+		// English words of up to about seven letters are usually a single
+		// token; longer ones split into common stems and suffixes
+		return 1 + (letters-1)/7
+	case other > 0:
+		// Common runs such as "//", "\":" or "},{" are single tokens
+		return (other + 1) / 2
+	default:
+		return 1
+	}
+}
+
+// CharTokenizer estimates one token per four characters, the usual rule of
+// thumb for English text. It is cheaper than ApproxTokenizer but ignores
+// how the text is structured.
+type CharTokenizer struct{}
+
+// CountTokens returns the estimated number of tokens in s
+func (CharTokenizer) CountTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// CountTokens returns the number of tokens in s according to
+// DefaultTokenizer
+func CountTokens(s string) int {
+	return DefaultTokenizer.CountTokens(s)
+}
+
+// Comparison holds the token counts of a value in TOON and in JSON
+type Comparison struct {
+	// TOON is the token count of the TOON encoding
+	TOON int
+
+	// JSON is the token count of compact JSON, as produced by json.Marshal
+	JSON int
+
+	// PrettyJSON is the token count of JSON indented with two spaces
+	PrettyJSON int
+}
+
+// Savings returns the fraction of tokens TOON saves compared to compact
+// JSON; it is negative when TOON is larger
+func (c *Comparison) Savings() float64 {
+	if c.JSON == 0 {
+		return 0
+	}
+	return 1 - float64(c.TOON)/float64(c.JSON)
+}
+
+// Compare encodes v as TOON with the given options and as compact and
+// indented JSON, and returns the token count of each. Tokens are counted
+// with the tokenizer set by WithTokenizer, or DefaultTokenizer.
+//
+// Example:
+//
+//	c, err := gotoon.Compare(data, gotoon.WithTokenizer(cl100k))
+//	fmt.Printf("TOON %d, JSON %d (%.0f%% saved)\n", c.TOON, c.JSON, c.Savings()*100)
+func Compare(v interface{}, opts ...EncodeOption) (*Comparison, error) {
+	options := resolveOptions(opts)
+	tokenizer := options.tokenizer()
+
+	encoded, err := Encode(v, opts...)
+	if err != nil {
+		return nil, err
+	}
+	compact, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	pretty, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Comparison{
+		TOON:       tokenizer.CountTokens(encoded),
+		JSON:       tokenizer.CountTokens(string(compact)),
+		PrettyJSON: tokenizer.CountTokens(string(pretty)),
+	}, nil
+}
@@ -0,0 +1,255 @@
+package gotoon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// byteTokenizer counts one token per byte
+type byteTokenizer struct{}
+
+func (byteTokenizer) CountTokens(s string) int {
+	return len(s)
+}
+
+func TestSplitPieces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input:    "Hello world's 12345  x\n\n y!!",
+			expected: []string{"Hello", " world", "'s", " ", "123", "45", " ", " x", "\n\n", " y", "!!"},
+		},
+		{
+			input:    "users[2]{id,name}:\n  1,Alice",
+			expected: []string{"users", "[", "2", "]{", "id", ",name", "}:\n", " ", " ", "1", ",Alice"},
+		},
+		{
+			input:    "WE'LL go  ",
+			expected: []string{"WE", "'LL", " go", "  "},
+		},
+		{
+			input:    "café 東京",
+			expected: []string{"café", " 東京"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			pieces := splitPieces(tt.input)
+			if !reflect.DeepEqual(pieces, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, pieces)
+			}
+			if strings.Join(pieces, "") != tt.input {
+				t.Errorf("pieces do not cover the input: %q", pieces)
+			}
+		})
+	}
+}
+
+func TestBPETokenizer(t *testing.T) {
+	var vocab strings.Builder
+	for rank, token := range []string{"he", "ll", "llo", " world"} {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	tokenizer, err := NewBPETokenizer(strings.NewReader(vocab.String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{input: "", expected: 0},
+		{input: "hello", expected: 2},
+		{input: "hello world", expected: 3},
+		{input: "hello worlds", expected: 9},
+		{input: "héllo", expected: 4},
+	}
+	for _, tt := range tests {
+		if count := tokenizer.CountTokens(tt.input); count != tt.expected {
+			t.Errorf("%q: expected %d tokens, got %d", tt.input, tt.expected, count)
+		}
+	}
+
+	for _, input := range []string{"aGU=", "!!! 1", "aGU= x"} {
+		if _, err := NewBPETokenizer(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestCL100KBase(t *testing.T) {
+	// Expected counts are from tiktoken's cl100k_base encoding
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{input: "", expected: 0},
+		{input: "hello world", expected: 2},
+		{input: "internationalization", expected: 2},
+		{input: "users[2]{id,name}:\n  1,Alice\n  2,Bob", expected: 19},
+		{input: `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]}`, expected: 20},
+		{input: "東京 café 😀", expected: 5},
+		{input: "I'm here,   they'LL see\r\n\n  x", expected: 12},
+	}
+	for _, tt := range tests {
+		if count := CL100KBase().CountTokens(tt.input); count != tt.expected {
+			t.Errorf("%q: expected %d tokens, got %d", tt.input, tt.expected, count)
+		}
+	}
+
+	if CL100KBase() != CL100KBase() {
+		t.Errorf("expected the vocabulary to be loaded once")
+	}
+	if count := CountTokens("internationalization"); count != 2 {
+		t.Errorf("expected CountTokens to use cl100k_base, got %d tokens", count)
+	}
+}
+
+func TestApproxTokenizer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{input: "", expected: 0},
+		{input: "hello world", expected: 2},
+		{input: "internationalization", expected: 3},
+		{input: "id: 12345", expected: 5},
+		{input: "\"},{\"", expected: 3},
+		{input: "東京", expected: 2},
+	}
+	for _, tt := range tests {
+		if count := (ApproxTokenizer{}).CountTokens(tt.input); count != tt.expected {
+			t.Errorf("%q: expected %d tokens, got %d", tt.input, tt.expected, count)
+		}
+	}
+
+	if CountTokens("hello world") != 2 {
+		t.Errorf("expected CountTokens to use the default tokenizer")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	data := map[string]interface{}{
+		"users": []map[string]interface{}{
+			{"id": 1, "name": "Alice", "role": "admin"},
+			{"id": 2, "name": "Bob", "role": "user"},
+			{"id": 3, "name": "Carol", "role": "user"},
+		},
+	}
+
+	c, err := Compare(data, WithTokenizer(byteTokenizer{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoded, _ := Encode(data)
+	compact, _ := json.Marshal(data)
+	pretty, _ := json.MarshalIndent(data, "", "  ")
+	expected := &Comparison{TOON: len(encoded), JSON: len(compact), PrettyJSON: len(pretty)}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+
+	c, err = Compare(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.TOON >= c.JSON || c.JSON >= c.PrettyJSON || c.Savings() <= 0 {
+		t.Errorf("expected TOON < JSON < pretty JSON, got %+v", c)
+	}
+
+	if _, err := Compare(map[string]interface{}{"f": func() {}}); err == nil {
+		t.Error("expected an error for an unsupported value")
+	}
+}
+
+func TestEncodeBest(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    interface{}
+		format   EncodingFormat
+		expected string
+	}{
+		{
+			name: "tabular data",
+			input: map[string]interface{}{"users": []map[string]interface{}{
+				{"id": 1, "name": "Alice"},
+				{"id": 2, "name": "Bob"},
+			}},
+			format:   FormatTOON,
+			expected: "users[2]{id,name}:\n  1,Alice\n  2,Bob",
+		},
+		{
+			name:     "single key chains",
+			input:    map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}}},
+			format:   FormatTOONExtended,
+			expected: "a.b.c: 1",
+		},
+		{
+			name:     "nested non-uniform arrays",
+			input:    []interface{}{[]interface{}{map[string]interface{}{"a": 1}}, []interface{}{map[string]interface{}{"b": 2}}},
+			format:   FormatJSON,
+			expected: `[[{"a":1}],[{"b":2}]]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			best, err := EncodeBest(tt.input, WithTokenizer(byteTokenizer{}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if best.Format != tt.format || best.Output != tt.expected || best.Tokens != len(tt.expected) {
+				t.Errorf("expected %s %q, got %s %q (%d tokens)", tt.format, tt.expected, best.Format, best.Output, best.Tokens)
+			}
+		})
+	}
+
+	t.Run("default tokenizer", func(t *testing.T) {
+		best, err := EncodeBest(map[string]interface{}{"id": 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if best.Format != FormatTOON || best.Tokens != CountTokens("id: 1") {
+			t.Errorf("unexpected result %+v", best)
+		}
+	})
+
+	t.Run("json uses the normalized value", func(t *testing.T) {
+		type account struct {
+			Name   string `toon:"name"`
+			Secret string `toon:"-"`
+			Tags   []int  `toon:"tags"`
+		}
+		input := []interface{}{[]account{{Name: "a", Secret: "hunter2", Tags: []int{1, 2, 3}}}}
+		best, err := EncodeBest(input, WithTokenizer(byteTokenizer{}), WithMaxArrayItems(2))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := `[[{"name":"a","tags":[1,2]}]]`
+		if best.Format != FormatJSON || best.Output != expected {
+			t.Errorf("expected json %q, got %s %q", expected, best.Format, best.Output)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := EncodeBest(map[string]interface{}{"f": func() {}}); err == nil {
+			t.Error("expected an error for an unsupported value")
+		}
+	})
+}
+
+func TestCharTokenizer(t *testing.T) {
+	for input, expected := range map[string]int{"": 0, "abcd": 1, "abcde": 2, "東京東京": 1} {
+		if count := (CharTokenizer{}).CountTokens(input); count != expected {
+			t.Errorf("%q: expected %d tokens, got %d", input, expected, count)
+		}
+	}
+}
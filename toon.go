@@ -1,6 +1,7 @@
-// Package gotoon provides encoding for Token-Oriented Object Notation (TOON),
-// a compact, human-readable format designed for passing structured data to
-// Large Language Models with significantly reduced token usage.
+// Package gotoon provides encoding and decoding for Token-Oriented Object
+// Notation (TOON), a compact, human-readable format designed for passing
+// structured data to Large Language Models with significantly reduced token
+// usage.
 //
 // TOON is optimized for uniform complex objects and provides 30-60% token
 // reduction compared to JSON while maintaining high LLM comprehension accuracy.
@@ -23,23 +24,69 @@
 //	// users[2]{id,name,role}:
 //	//   1,Alice,admin
 //	//   2,Bob,user
+//
+// Decoding parses TOON text back into generic Go values:
+//
+//	value, err := gotoon.Decode(encoded)
+//
+// or directly into typed Go values:
+//
+//	var users struct {
+//		Users []User `json:"users"`
+//	}
+//	err := gotoon.Unmarshal([]byte(encoded), &users)
 package gotoon
 
+import "reflect"
+
 // Encode converts any Go value to TOON format string.
 //
 // The input value is normalized to a JSON-compatible representation:
-//   - Primitives (bool, int, float, string) are encoded as-is
-//   - Structs are converted to maps using exported fields (respects json tags)
+//   - Primitives (bool, int, float, string) are encoded as-is; integers
+//     keep their exact value and are never rounded through float64
+//   - json.Number, *big.Int, *big.Float and *big.Rat are encoded as exact
+//     decimals; a big.Rat whose expansion does not terminate is encoded as
+//     a fraction string such as "1/3"
+//   - Structs are converted to maps using exported fields, honouring json
+//     tags as encoding/json does (renaming, "-", omitempty, omitzero, string)
+//     and promoting the fields of embedded structs
+//   - A toon struct tag takes precedence over json and adds the quote, list
+//     and header=<name> options
 //   - Slices and arrays remain as arrays
-//   - Maps with string keys remain as objects
+//   - Maps become objects; keys are converted as encoding/json does
+//     (strings as-is, encoding.TextMarshaler, then integers) and sorted
 //   - time.Time is converted to RFC3339Nano format
-//   - NaN and Infinity become null
-//   - Nil, undefined, functions become null
+//   - Types implementing Marshaler are encoded as the value MarshalTOON
+//     returns; otherwise encoding.TextMarshaler produces a string and
+//     json.Marshaler output is decoded and encoded as TOON
+//   - Nil pointers and interfaces become null
+//   - Functions, channels, complex numbers, maps with other key types, NaN
+//     and Infinity return an *UnsupportedTypeError or *UnsupportedValueError
+//     naming the path to the value; with WithStrict(false) they become null
+//   - Cycles (such as parent pointers) and values nested deeper than the
+//     maximum depth return an *UnsupportedValueError
 //
 // Options can be provided to customize the encoding:
 //   - WithIndent(n): Set indentation size (default: 2 spaces)
 //   - WithDelimiter(d): Set delimiter for arrays ("," | "\t" | "|", default: ",")
 //   - WithLengthMarker(): Add "#" prefix to array lengths (e.g., [#3])
+//   - WithKeyOrder(o): Order keys by declaration (default) or alphabetically
+//   - WithKeyCompare(cmp): Order keys with a custom comparison function
+//   - WithStrict(b): Return errors for unsupported values (default: true)
+//   - WithMaxDepth(n): Limit nesting of arrays and objects (default: 1000)
+//   - WithSparseTabular(m): Use tabular format for objects with missing
+//     fields, written as empty cells or null (default: off)
+//   - WithSparseThreshold(t): Largest share of absent cells in a sparse
+//     table (default: 0.5)
+//   - WithKeyFolding(): Collapse chains of single-key objects into dotted
+//     keys (e.g., config.db.host: x)
+//   - WithNestedTabular(): Use tabular format for objects holding nested
+//     objects (as dotted columns) and arrays of primitives (as [a,b] cells)
+//   - WithTokenizer(t): Count tokens with t where output is measured, such
+//     as in Compare (default: DefaultTokenizer)
+//   - WithTokenBudget(n): Truncate arrays and strings to fit in n tokens
+//   - WithMaxArrayItems(n): Encode at most n items per array
+//   - WithMaxStringLen(n): Encode at most n characters per string
 //
 // Example with options:
 //
@@ -49,14 +96,95 @@ package gotoon
 //		gotoon.WithLengthMarker(),
 //	)
 func Encode(input interface{}, opts ...EncodeOption) (string, error) {
-	// Normalize the input value
-	normalized := normalizeValue(input)
-
 	// Resolve options
 	options := resolveOptions(opts)
 
-	// Encode the normalized value
-	result := encodeValue(normalized, options)
+	// Truncation works on the normalized tree
+	if options.truncates() {
+		result, err := encodeWithResult(input, options)
+		if err != nil {
+			return "", err
+		}
+		return result.Output, nil
+	}
+
+	// Encode directly from the Go value
+	writer := NewLineWriter(options.Indent)
+	if err := encodeDirect(input, writer, options); err != nil {
+		return "", err
+	}
+
+	return writer.String(), nil
+}
+
+// Decode parses a TOON document into generic Go values.
+//
+// The result uses the same generic shapes as encoding/json:
+//   - Objects become map[string]interface{}
+//   - Arrays (inline, tabular and list form) become []interface{}
+//   - Numbers become float64
+//   - Strings, booleans and null become string, bool and nil
+//   - Empty cells in tabular rows leave the field out of that row's object
+//   - Bracketed tabular cells such as [a,b] become []interface{}
+//
+// An empty document decodes to an empty object. Declared array lengths and
+// tabular field counts are checked; malformed input returns a *SyntaxError.
+//
+// Options can be provided to customize the decoding:
+//   - WithPathExpansion(): Split unquoted dotted keys and column names such
+//     as config.db.host into nested objects, reversing WithKeyFolding and
+//     WithNestedTabular
+func Decode(input string, opts ...DecodeOption) (interface{}, error) {
+	options := resolveDecodeOptions(opts)
+
+	lines, err := splitLines(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{lines: lines, expandPaths: options.ExpandPaths}
+	value, err := p.parseDocument()
+	if err != nil {
+		return nil, err
+	}
+	return genericValue(value, "")
+}
+
+// Unmarshal parses a TOON document and stores the result in the value pointed
+// to by v, which must be a non-nil pointer.
+//
+// Values are assigned using the same rules Encode uses on the way out:
+//   - Objects fill structs (matching keys against json tags or field names,
+//     case-insensitively as a fallback) and maps, converting keys back
+//     through encoding.TextUnmarshaler or to integers as needed
+//   - Arrays fill slices and arrays
+//   - Numbers are parsed directly into the target integer or float type, so
+//     large integers keep their precision
+//   - Strings fill string fields and types implementing
+//     encoding.TextUnmarshaler, such as time.Time; numbers fill
+//     json.Number and math/big types from their exact text
+//   - Interface values receive the same shapes that Decode returns
+//
+// Unknown keys are ignored. Values that cannot be stored in the target type
+// return an *UnmarshalTypeError describing where the mismatch occurred.
+// Decoding options are the same as for Decode.
+func Unmarshal(data []byte, v interface{}, opts ...DecodeOption) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+	options := resolveDecodeOptions(opts)
+
+	lines, err := splitLines(string(data))
+	if err != nil {
+		return err
+	}
+
+	p := &parser{lines: lines, useNumber: true, expandPaths: options.ExpandPaths}
+	value, err := p.parseDocument()
+	if err != nil {
+		return err
+	}
 
-	return result, nil
+	return assignValue(rv.Elem(), value, "")
 }
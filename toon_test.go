@@ -1,6 +1,14 @@
 package gotoon
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -382,3 +390,1139 @@ func TestREADMEExample(t *testing.T) {
 		t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
 	}
 }
+
+type zeroer struct {
+	Value int
+}
+
+func (z zeroer) IsZero() bool {
+	return z.Value < 0
+}
+
+func TestEncodeStructTags(t *testing.T) {
+	type Tagged struct {
+		Name     string  `json:"name,omitempty"`
+		Nick     string  `json:"nick,omitempty"`
+		Count    int     `json:",omitempty"`
+		Ptr      *int    `json:"ptr,omitempty"`
+		Tags     []int   `json:"tags,omitempty"`
+		Custom   zeroer  `json:"custom,omitzero"`
+		Zero     float64 `json:"zero,omitzero"`
+		ID       int64   `json:"id,string"`
+		Flag     bool    `json:"flag,string"`
+		Label    string  `json:"label,string"`
+		Skipped  string  `json:"-"`
+		Dash     string  `json:"-,"`
+		Untagged string
+	}
+
+	input := Tagged{
+		Name:     "Ada",
+		Custom:   zeroer{Value: -1},
+		ID:       42,
+		Flag:     true,
+		Label:    "x",
+		Skipped:  "secret",
+		Dash:     "dash",
+		Untagged: "plain",
+	}
+
+	result, err := Encode(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "name: Ada\nid: \"42\"\nflag: \"true\"\nlabel: \"\\\"x\\\"\"\n\"-\": dash\nUntagged: plain"
+	if result != expected {
+		t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+	}
+}
+
+func TestEncodeToonTags(t *testing.T) {
+	type Item struct {
+		ID          int      `json:"id"`
+		Code        string   `json:"code" toon:",quote"`
+		Description string   `json:"description" toon:"description,header=desc"`
+		Secret      string   `json:"secret" toon:"-"`
+		Internal    string   `json:"-" toon:"internal,omitempty"`
+		Renamed     string   `json:"json_name" toon:"toon_name"`
+		Tags        []string `json:"tags,omitempty" toon:",quote,list"`
+	}
+
+	t.Run("tabular with header rename and quoting", func(t *testing.T) {
+		input := map[string]interface{}{
+			"items": []Item{
+				{ID: 1, Code: "A1", Description: "first", Secret: "x", Renamed: "r1"},
+				{ID: 2, Code: "B2", Description: "second", Secret: "y", Renamed: "r2"},
+			},
+		}
+		result, err := Encode(input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "items[2]{id,code,desc,toon_name}:\n  1,\"A1\",first,r1\n  2,\"B2\",second,r2"
+		if result != expected {
+			t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+		}
+	})
+
+	t.Run("forced list format", func(t *testing.T) {
+		input := Item{ID: 1, Code: "A1", Internal: "i", Tags: []string{"a", "b"}}
+		result, err := Encode(input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "id: 1\ncode: \"A1\"\ndescription: \"\"\ninternal: i\ntoon_name: \"\"\ntags[2]:\n  - \"a\"\n  - \"b\""
+		if result != expected {
+			t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+		}
+	})
+}
+
+func TestEncodeKeyOrder(t *testing.T) {
+	type Product struct {
+		ID          int    `json:"id"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	input := map[string]interface{}{
+		"products": []Product{
+			{ID: 1, Name: "Widget", Description: "Small"},
+			{ID: 2, Name: "Gadget", Description: "Large"},
+		},
+		"owner": Product{ID: 3, Name: "Ada", Description: "Owner"},
+	}
+
+	tests := []struct {
+		name     string
+		opts     []EncodeOption
+		expected string
+	}{
+		{
+			name:     "declaration order by default",
+			expected: "owner:\n  id: 3\n  name: Ada\n  description: Owner\nproducts[2]{id,name,description}:\n  1,Widget,Small\n  2,Gadget,Large",
+		},
+		{
+			name:     "alphabetical",
+			opts:     []EncodeOption{WithKeyOrder(KeyOrderAlphabetical)},
+			expected: "owner:\n  description: Owner\n  id: 3\n  name: Ada\nproducts[2]{description,id,name}:\n  Small,1,Widget\n  Large,2,Gadget",
+		},
+		{
+			name: "custom comparison",
+			opts: []EncodeOption{WithKeyCompare(func(a, b string) int {
+				// Names first, everything else keeps its declaration order
+				if a == "name" && b != "name" {
+					return -1
+				}
+				if b == "name" && a != "name" {
+					return 1
+				}
+				return 0
+			})},
+			expected: "owner:\n  name: Ada\n  id: 3\n  description: Owner\nproducts[2]{name,id,description}:\n  Widget,1,Small\n  Gadget,2,Large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(input, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+type status int
+
+func (s status) MarshalTOON() (interface{}, error) {
+	switch s {
+	case 1:
+		return "active", nil
+	case 2:
+		return "archived", nil
+	}
+	return nil, errors.New("unknown status")
+}
+
+type money struct {
+	cents int64
+}
+
+func (m *money) MarshalTOON() (interface{}, error) {
+	return fmt.Sprintf("%d.%02d", m.cents/100, m.cents%100), nil
+}
+
+type uuid [4]byte
+
+func (u uuid) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%x-%x", u[:2], u[2:])), nil
+}
+
+type point struct {
+	x, y int
+}
+
+func (p point) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"y":%d,"x":%d}`, p.y, p.x)), nil
+}
+
+func TestEncodeMarshalers(t *testing.T) {
+	type Account struct {
+		ID      uuid       `json:"id"`
+		Status  status     `json:"status"`
+		Balance money      `json:"balance"`
+		Addr    netip.Addr `json:"addr"`
+		Origin  point      `json:"origin"`
+	}
+
+	input := &Account{
+		ID:      uuid{0xde, 0xad, 0xbe, 0xef},
+		Status:  1,
+		Balance: money{cents: 1234},
+		Addr:    netip.MustParseAddr("10.0.0.1"),
+		Origin:  point{x: 1, y: 2},
+	}
+
+	result, err := Encode(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "id: dead-beef\nstatus: active\nbalance: \"12.34\"\naddr: 10.0.0.1\norigin:\n  x: 1\n  y: 2"
+	if result != expected {
+		t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+	}
+
+	t.Run("tabular", func(t *testing.T) {
+		result, err := Encode([]map[string]interface{}{
+			{"id": 1, "status": status(1)},
+			{"id": 2, "status": status(2)},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "[2]{id,status}:\n  1,active\n  2,archived"
+		if result != expected {
+			t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := Encode(map[string]interface{}{"status": status(9)})
+		var marshalerErr *MarshalerError
+		if !errors.As(err, &marshalerErr) {
+			t.Fatalf("expected *MarshalerError, got %v", err)
+		}
+		if marshalerErr.Type != reflect.TypeOf(status(0)) {
+			t.Errorf("unexpected type %v", marshalerErr.Type)
+		}
+	})
+}
+
+func TestEncodeStrict(t *testing.T) {
+	type Stats struct {
+		Ratio float64 `json:"ratio"`
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		path  string
+		value bool
+	}{
+		{name: "func", input: map[string]interface{}{"fn": func() {}}, path: "fn"},
+		{name: "chan", input: []interface{}{1, make(chan int)}, path: "[1]"},
+		{name: "complex", input: complex(1, 2)},
+		{name: "float keys", input: map[string]interface{}{"m": map[float64]string{1.5: "a"}}, path: "m"},
+		{name: "NaN", input: map[string]interface{}{"users": []Stats{{1}, {math.NaN()}}}, path: "users[1].ratio", value: true},
+		{name: "Inf", input: math.Inf(1), value: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Encode(tt.input)
+			var typeErr *UnsupportedTypeError
+			var valueErr *UnsupportedValueError
+			switch {
+			case tt.value && errors.As(err, &valueErr):
+				if valueErr.Path != tt.path {
+					t.Errorf("expected path %q, got %q", tt.path, valueErr.Path)
+				}
+			case !tt.value && errors.As(err, &typeErr):
+				if typeErr.Path != tt.path {
+					t.Errorf("expected path %q, got %q", tt.path, typeErr.Path)
+				}
+			default:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			result, err := Encode(tt.input, WithStrict(false))
+			if err != nil {
+				t.Fatalf("unexpected error in lenient mode: %v", err)
+			}
+			if !strings.Contains(result, "null") {
+				t.Errorf("expected null in lenient output, got:\n%s", result)
+			}
+		})
+	}
+}
+
+func TestEncodeNestedArrays(t *testing.T) {
+	input := map[string]interface{}{
+		"groups": []interface{}{
+			[]interface{}{map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2}},
+			[]interface{}{[]int{1, 2}, "x"},
+		},
+	}
+
+	result, err := Encode(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "groups[2]:\n  - [2]:\n    - id: 1\n    - id: 2\n  - [2]:\n    - [2]: 1,2\n    - x"
+	if result != expected {
+		t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+	}
+
+	decoded, err := Decode(result)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	normalized, _ := normalizeValue(input, defaultOptions())
+	if !reflect.DeepEqual(decoded, plainValue(normalized)) {
+		t.Errorf("round trip mismatch: %#v", decoded)
+	}
+}
+
+func TestEncodeNumbers(t *testing.T) {
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	bigFloat, _ := new(big.Float).SetPrec(200).SetString("3.14159265358979323846264338327950288")
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{name: "int64 above 2^53", input: int64(9007199254740993), expected: "9007199254740993"},
+		{name: "max int64", input: int64(math.MaxInt64), expected: "9223372036854775807"},
+		{name: "min int64", input: int64(math.MinInt64), expected: "-9223372036854775808"},
+		{name: "max uint64", input: uint64(math.MaxUint64), expected: "18446744073709551615"},
+		{name: "large float", input: 1e21, expected: "1000000000000000000000"},
+		{name: "small float", input: 1.5e-7, expected: "0.00000015"},
+		{name: "json.Number", input: json.Number("12345678901234567890.5"), expected: "12345678901234567890.5"},
+		{name: "json.Number exponent", input: json.Number("-1.25e-3"), expected: "-0.00125"},
+		{name: "big.Int", input: bigInt, expected: "123456789012345678901234567890"},
+		{name: "big.Float", input: bigFloat, expected: "3.14159265358979323846264338327950288"},
+		{name: "big.Rat", input: big.NewRat(1, 8), expected: "0.125"},
+		{name: "big.Rat integer", input: big.NewRat(84, 2), expected: "42"},
+		{name: "big.Rat fraction", input: big.NewRat(1, 3), expected: "1/3"},
+		{name: "big.Int value", input: struct{ N big.Int }{N: *big.NewInt(7)}, expected: "N: 7"},
+		{name: "zero json.Number", input: struct{ J json.Number }{}, expected: "J: 0"},
+		{name: "zero json.Number rows", input: []struct{ J json.Number }{{}, {J: "2"}}, expected: "[2]{J}:\n  0\n  2"},
+		{name: "json.Number negative zero", input: json.Number("-0"), expected: "0"},
+		{name: "json.Number negative zero fraction", input: json.Number("-0.00e1"), expected: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+
+			best, err := EncodeBest(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected EncodeBest error: %v", err)
+			}
+			if best.Format == FormatTOON && best.Output != tt.expected {
+				t.Errorf("expected EncodeBest %q, got %q", tt.expected, best.Output)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		type Row struct {
+			ID   int64  `json:"id"`
+			Hash uint64 `json:"hash"`
+		}
+		rows := []Row{{ID: math.MaxInt64, Hash: math.MaxUint64}, {ID: -9007199254740993, Hash: 1}}
+		encoded, err := Encode(rows)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var decoded []Row
+		if err := Unmarshal([]byte(encoded), &decoded); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, rows) {
+			t.Errorf("expected %v, got %v", rows, decoded)
+		}
+	})
+
+	t.Run("invalid json.Number", func(t *testing.T) {
+		var valueErr *UnsupportedValueError
+		if _, err := Encode(json.Number("12abc")); !errors.As(err, &valueErr) {
+			t.Errorf("expected *UnsupportedValueError, got %v", err)
+		}
+	})
+
+	t.Run("exponent limit", func(t *testing.T) {
+		result, err := Encode(json.Number("1e-300"))
+		if err != nil || len(result) != 302 {
+			t.Errorf("expected a 302 digit expansion, got %d digits, %v", len(result), err)
+		}
+		for _, n := range []string{"1e999999", "1e-999999", "1e9999999999999999999"} {
+			var valueErr *UnsupportedValueError
+			if _, err := Encode(json.Number(n)); !errors.As(err, &valueErr) {
+				t.Errorf("%s: expected *UnsupportedValueError, got %v", n, err)
+			}
+		}
+
+		huge := new(big.Float).SetMantExp(big.NewFloat(1), 200000)
+		var valueErr *UnsupportedValueError
+		if _, err := Encode(huge); !errors.As(err, &valueErr) {
+			t.Errorf("2^200000: expected *UnsupportedValueError, got %v", err)
+		}
+		if result, err := Encode(new(big.Float).SetMantExp(big.NewFloat(1), 2000), WithStrict(false)); err != nil || result != "null" {
+			t.Errorf("2^2000: expected null without strict mode, got %q, %v", result, err)
+		}
+	})
+}
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "high"}[l]), nil
+}
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 0
+	case "high":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+func TestEncodeMapKeys(t *testing.T) {
+	type Stats struct {
+		Count int `json:"count"`
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{name: "int keys", input: map[int]string{2: "b", 10: "j", -1: "z"}, expected: "\"-1\": z\n\"10\": j\n\"2\": b"},
+		{name: "uint keys", input: map[uint8]bool{7: true}, expected: "\"7\": true"},
+		{name: "text marshaler keys", input: map[level]Stats{1: {Count: 3}, 0: {Count: 5}}, expected: "high:\n  count: 3\nlow:\n  count: 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+type BaseEntity struct {
+	ID      int64  `json:"id"`
+	Created string `json:"created"`
+}
+
+type audit struct {
+	UpdatedBy string `json:"updated_by"`
+}
+
+type Named struct {
+	Name string
+}
+
+type Titled struct {
+	Name string
+}
+
+type Labelled struct {
+	Name string `json:"name"`
+}
+
+func TestEncodeEmbedded(t *testing.T) {
+	type Order struct {
+		BaseEntity
+		*audit
+		Total float64 `json:"total"`
+	}
+	type Conflicts struct {
+		Named    // Name at depth 1, untagged
+		Labelled // name at depth 1, tagged: distinct key
+		Extra    struct {
+			Named
+		} `json:"extra"`
+	}
+	type Shadowed struct {
+		BaseEntity
+		ID string `json:"id"`
+	}
+	type TaggedEmbed struct {
+		BaseEntity `json:"base"`
+		Note       string `json:"note"`
+	}
+	type Ambiguous struct {
+		Named
+		Titled
+		Kept int
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{
+			name:     "promoted fields",
+			input:    Order{BaseEntity: BaseEntity{ID: 1, Created: "2025-01-01"}, audit: &audit{UpdatedBy: "ada"}, Total: 9.5},
+			expected: "id: 1\ncreated: 2025-01-01\nupdated_by: ada\ntotal: 9.5",
+		},
+		{
+			name:     "nil embedded pointer",
+			input:    Order{BaseEntity: BaseEntity{ID: 2}, Total: 1},
+			expected: "id: 2\ncreated: \"\"\ntotal: 1",
+		},
+		{
+			name:     "conflicts",
+			input:    Conflicts{Named: Named{Name: "a"}, Labelled: Labelled{Name: "b"}},
+			expected: "Name: a\nname: b\nextra:\n  Name: \"\"",
+		},
+		{
+			name:     "shallower field wins",
+			input:    Shadowed{BaseEntity: BaseEntity{ID: 1, Created: "x"}, ID: "outer"},
+			expected: "created: x\nid: outer",
+		},
+		{
+			name:     "tagged embedded struct",
+			input:    TaggedEmbed{BaseEntity: BaseEntity{ID: 3, Created: "y"}, Note: "n"},
+			expected: "base:\n  id: 3\n  created: y\nnote: n",
+		},
+		{
+			name:     "ambiguous field dropped",
+			input:    Ambiguous{Kept: 1},
+			expected: "Kept: 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+
+			// The decoded shape matches encoding/json
+			data, err := json.Marshal(tt.input)
+			if err != nil {
+				t.Fatalf("json.Marshal failed: %v", err)
+			}
+			var expected interface{}
+			if err := json.Unmarshal(data, &expected); err != nil {
+				t.Fatalf("json.Unmarshal failed: %v", err)
+			}
+			decoded, err := Decode(result)
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, expected) {
+				t.Errorf("shape differs from encoding/json:\nexpected %#v\ngot %#v", expected, decoded)
+			}
+		})
+	}
+}
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Parent   *treeNode   `json:"parent,omitempty"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+func TestEncodeCycles(t *testing.T) {
+	root := &treeNode{Name: "root"}
+	child := &treeNode{Name: "child", Parent: root}
+	root.Children = []*treeNode{child}
+
+	selfMap := map[string]interface{}{}
+	selfMap["self"] = selfMap
+
+	selfSlice := []interface{}{nil}
+	selfSlice[0] = selfSlice
+
+	tests := []struct {
+		name  string
+		input interface{}
+		path  string
+	}{
+		{name: "parent pointer", input: root, path: "children[0].parent"},
+		{name: "map", input: selfMap, path: "self"},
+		{name: "slice", input: selfSlice, path: "[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Encode(tt.input)
+			var valueErr *UnsupportedValueError
+			if !errors.As(err, &valueErr) {
+				t.Fatalf("expected *UnsupportedValueError, got %v", err)
+			}
+			if valueErr.Path != tt.path || !strings.Contains(err.Error(), "cycle") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("shared values are not cycles", func(t *testing.T) {
+		shared := &treeNode{Name: "leaf"}
+		result, err := Encode([]*treeNode{shared, shared})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "[2]{name}:\n  leaf\n  leaf"
+		if result != expected {
+			t.Errorf("expected:\n%s\n\ngot:\n%s", expected, result)
+		}
+	})
+}
+
+func TestEncodeMaxDepth(t *testing.T) {
+	var nested interface{} = "leaf"
+	for i := 0; i < 5; i++ {
+		nested = map[string]interface{}{"n": nested}
+	}
+
+	if _, err := Encode(nested, WithMaxDepth(5)); err != nil {
+		t.Fatalf("unexpected error at the limit: %v", err)
+	}
+
+	_, err := Encode(nested, WithMaxDepth(4))
+	var valueErr *UnsupportedValueError
+	if !errors.As(err, &valueErr) {
+		t.Fatalf("expected *UnsupportedValueError, got %v", err)
+	}
+	if valueErr.Path != "n.n.n.n" {
+		t.Errorf("unexpected path %q", valueErr.Path)
+	}
+
+	deep := []interface{}{}
+	for i := 0; i < DefaultMaxDepth; i++ {
+		deep = []interface{}{deep}
+	}
+	if _, err := Encode(deep); !errors.As(err, &valueErr) {
+		t.Errorf("expected the default limit to apply, got %v", err)
+	}
+	if _, err := Encode(deep, WithMaxDepth(0)); err != nil {
+		t.Errorf("unexpected error without a limit: %v", err)
+	}
+}
+
+func TestEncodeSparseTabular(t *testing.T) {
+	type Contact struct {
+		ID    int    `json:"id"`
+		Email string `json:"email,omitempty" toon:",header=mail"`
+		Phone string `json:"phone,omitempty"`
+	}
+
+	rows := []interface{}{
+		map[string]interface{}{"id": 1, "name": "Alice", "role": "admin"},
+		map[string]interface{}{"id": 2, "name": "Bob"},
+		map[string]interface{}{"id": 3, "role": "user"},
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		opts     []EncodeOption
+		expected string
+	}{
+		{
+			name:     "off by default",
+			input:    map[string]interface{}{"users": rows},
+			expected: "users[3]:\n  - id: 1\n    name: Alice\n    role: admin\n  - id: 2\n    name: Bob\n  - id: 3\n    role: user",
+		},
+		{
+			name:     "empty cells",
+			input:    map[string]interface{}{"users": rows},
+			opts:     []EncodeOption{WithSparseTabular(SparseEmpty)},
+			expected: "users[3]{id,name,role}:\n  1,Alice,admin\n  2,Bob,\n  3,,user",
+		},
+		{
+			name:     "null cells",
+			input:    map[string]interface{}{"users": rows},
+			opts:     []EncodeOption{WithSparseTabular(SparseNull), WithDelimiter("|")},
+			expected: "users[3|]{id|name|role}:\n  1|Alice|admin\n  2|Bob|null\n  3|null|user",
+		},
+		{
+			name:     "alphabetical columns",
+			input:    []interface{}{map[string]interface{}{"b": 1}, map[string]interface{}{"a": 2, "b": 3}},
+			opts:     []EncodeOption{WithSparseTabular(SparseEmpty), WithKeyOrder(KeyOrderAlphabetical)},
+			expected: "[2]{a,b}:\n  ,1\n  2,3",
+		},
+		{
+			name:     "above threshold",
+			input:    map[string]interface{}{"users": rows},
+			opts:     []EncodeOption{WithSparseTabular(SparseEmpty), WithSparseThreshold(0.2)},
+			expected: "users[3]:\n  - id: 1\n    name: Alice\n    role: admin\n  - id: 2\n    name: Bob\n  - id: 3\n    role: user",
+		},
+		{
+			name:     "leading empty cell with tabs",
+			input:    []interface{}{map[string]interface{}{"b": 1}, map[string]interface{}{"a": 2, "b": 3}},
+			opts:     []EncodeOption{WithSparseTabular(SparseEmpty), WithKeyOrder(KeyOrderAlphabetical), WithDelimiter("\t")},
+			expected: "[2\t]:\n  - b: 1\n  - a: 2\n    b: 3",
+		},
+		{
+			name:     "nested values",
+			input:    []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{"b": []int{1}}},
+			opts:     []EncodeOption{WithSparseTabular(SparseEmpty)},
+			expected: "[2]:\n  - a: 1\n  - b[1]: 1",
+		},
+		{
+			name:     "omitempty struct fields",
+			input:    []Contact{{ID: 1, Phone: "555-0100"}, {ID: 2, Email: "b@x.io"}},
+			opts:     []EncodeOption{WithSparseTabular(SparseEmpty)},
+			expected: "[2]{id,phone,mail}:\n  1,555-0100,\n  2,,b@x.io",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(tt.input, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		encoded, err := Encode(map[string]interface{}{"users": rows}, WithSparseTabular(SparseEmpty))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		decoded, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := map[string]interface{}{"users": []interface{}{
+			map[string]interface{}{"id": 1.0, "name": "Alice", "role": "admin"},
+			map[string]interface{}{"id": 2.0, "name": "Bob"},
+			map[string]interface{}{"id": 3.0, "role": "user"},
+		}}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("expected %#v, got %#v", expected, decoded)
+		}
+	})
+}
+
+func TestEncodeKeyFolding(t *testing.T) {
+	type DB struct {
+		Host string `json:"host"`
+	}
+	type Config struct {
+		DB DB `json:"db"`
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{
+			name:     "single key chain",
+			input:    map[string]interface{}{"config": map[string]interface{}{"db": map[string]interface{}{"host": "x"}}},
+			expected: "config.db.host: x",
+		},
+		{
+			name: "stops at an object with several keys",
+			input: map[string]interface{}{"config": map[string]interface{}{"db": map[string]interface{}{
+				"host": "x",
+				"port": 5432,
+			}}},
+			expected: "config.db:\n  host: x\n  port: 5432",
+		},
+		{
+			name:     "array leaf",
+			input:    map[string]interface{}{"a": map[string]interface{}{"tags": []string{"x", "y"}}},
+			expected: "a.tags[2]: x,y",
+		},
+		{
+			name:     "empty object leaf",
+			input:    map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{}}},
+			expected: "a.b:",
+		},
+		{
+			name:     "segment that is not an identifier",
+			input:    map[string]interface{}{"a": map[string]interface{}{"my key": map[string]interface{}{"c": 1}}},
+			expected: "a:\n  \"my key\":\n    c: 1",
+		},
+		{
+			name: "collision with a sibling",
+			input: map[string]interface{}{
+				"a":   map[string]interface{}{"b": 1},
+				"a.b": 2,
+			},
+			expected: "a:\n  b: 1\n\"a.b\": 2",
+		},
+		{
+			name:     "dotted keys are quoted",
+			input:    map[string]interface{}{"k": map[string]interface{}{"x.y": map[string]interface{}{"z": 1}}, "rows": []map[string]interface{}{{"a.b": 1}}},
+			expected: "k:\n  \"x.y\":\n    z: 1\nrows[1]{\"a.b\"}:\n  1",
+		},
+		{
+			name:     "list items",
+			input:    []interface{}{map[string]interface{}{"a": map[string]interface{}{"b": 1}, "c": map[string]interface{}{"d": 2}}, 3},
+			expected: "[2]:\n  - a.b: 1\n    c.d: 2\n  - 3",
+		},
+		{
+			name:     "structs",
+			input:    Config{DB: DB{Host: "x"}},
+			expected: "db.host: x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(tt.input, WithKeyFolding())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		input := map[string]interface{}{
+			"config": map[string]interface{}{
+				"db":    map[string]interface{}{"host": "x", "port": 5432.0},
+				"cache": map[string]interface{}{"ttl": map[string]interface{}{"seconds": 30.0}},
+			},
+			"tags": []interface{}{map[string]interface{}{"meta": map[string]interface{}{"id": 1.0}}},
+		}
+		encoded, err := Encode(input, WithKeyFolding())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		decoded, err := Decode(encoded, WithPathExpansion())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, input) {
+			t.Errorf("expected %#v, got %#v", input, decoded)
+		}
+	})
+
+	t.Run("round trip with dotted keys", func(t *testing.T) {
+		inputs := []map[string]interface{}{
+			{"a.b": 1.0, "a": map[string]interface{}{"c": 2.0}},
+			{"a": map[string]interface{}{"b": 1.0}, "a.b": 2.0},
+			{"x": map[string]interface{}{"y.z": map[string]interface{}{"w": 1.0}}},
+			{"rows": []interface{}{
+				map[string]interface{}{"a.b": 1.0, "c": 2.0},
+				map[string]interface{}{"a.b": 3.0, "c": 4.0},
+			}},
+		}
+		for _, input := range inputs {
+			encoded, err := Encode(input, WithKeyFolding())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			decoded, err := Decode(encoded, WithPathExpansion())
+			if err != nil {
+				t.Fatalf("unexpected error: %v\n%s", err, encoded)
+			}
+			if !reflect.DeepEqual(decoded, input) {
+				t.Errorf("expected %#v, got %#v\n%s", input, decoded, encoded)
+			}
+		}
+	})
+}
+
+func TestEncodeNestedTabular(t *testing.T) {
+	type Owner struct {
+		ID   int    `json:"id"`
+		Name string `json:"name" toon:",header=who"`
+	}
+	type Repo struct {
+		ID    int      `json:"id"`
+		Owner Owner    `json:"owner"`
+		Tags  []string `json:"tags"`
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		opts     []EncodeOption
+		expected string
+	}{
+		{
+			name: "off by default",
+			input: []interface{}{
+				map[string]interface{}{"id": 1, "tags": []string{"a"}},
+			},
+			expected: "[1]:\n  - id: 1\n    tags[1]: a",
+		},
+		{
+			name: "structs",
+			input: map[string]interface{}{"repos": []Repo{
+				{ID: 1, Owner: Owner{ID: 7, Name: "ada"}, Tags: []string{"go", "cli"}},
+				{ID: 2, Owner: Owner{ID: 8, Name: "bob"}, Tags: []string{}},
+			}},
+			opts:     []EncodeOption{WithNestedTabular()},
+			expected: "repos[2]{id,owner.id,owner.who,tags}:\n  1,7,ada,[go,cli]\n  2,8,bob,[]",
+		},
+		{
+			name: "pipe delimiter",
+			input: []interface{}{
+				map[string]interface{}{"id": 1, "tags": []interface{}{"a|b", 2}},
+				map[string]interface{}{"id": 2, "tags": []interface{}{}},
+			},
+			opts:     []EncodeOption{WithNestedTabular(), WithDelimiter("|")},
+			expected: "[2|]{id|tags}:\n  1|[\"a|b\"|2]\n  2|[]",
+		},
+		{
+			name: "nested objects must match",
+			input: []interface{}{
+				map[string]interface{}{"id": 1, "owner": map[string]interface{}{"id": 7}},
+				map[string]interface{}{"id": 2, "owner": map[string]interface{}{"name": "bob"}},
+			},
+			opts:     []EncodeOption{WithNestedTabular()},
+			expected: "[2]:\n  - id: 1\n    owner:\n      id: 7\n  - id: 2\n    owner:\n      name: bob",
+		},
+		{
+			name: "with sparse cells",
+			input: []interface{}{
+				map[string]interface{}{"id": 1, "owner": map[string]interface{}{"id": 7}},
+				map[string]interface{}{"id": 2, "owner": map[string]interface{}{"id": 8, "name": "bob"}},
+			},
+			opts:     []EncodeOption{WithNestedTabular(), WithSparseTabular(SparseEmpty)},
+			expected: "[2]{id,owner.id,owner.name}:\n  1,7,\n  2,8,bob",
+		},
+		{
+			name: "arrays of objects stay in list format",
+			input: []interface{}{
+				map[string]interface{}{"id": 1, "items": []interface{}{map[string]interface{}{"x": 1}}},
+			},
+			opts:     []EncodeOption{WithNestedTabular()},
+			expected: "[1]:\n  - id: 1\n    items[1]{x}:\n      1",
+		},
+		{
+			name: "empty nested object",
+			input: []interface{}{
+				map[string]interface{}{"id": 1, "meta": map[string]interface{}{}},
+			},
+			opts:     []EncodeOption{WithNestedTabular()},
+			expected: "[1]:\n  - id: 1\n    meta:",
+		},
+		{
+			name: "dotted keys keep list format",
+			input: []interface{}{
+				map[string]interface{}{"a.b": 1, "a": map[string]interface{}{"c": 2}},
+			},
+			opts:     []EncodeOption{WithNestedTabular()},
+			expected: "[1]:\n  - a:\n      c: 2\n    \"a.b\": 1",
+		},
+		{
+			name: "dotted columns are quoted",
+			input: []interface{}{
+				map[string]interface{}{"a.b": 1, "c": 2},
+			},
+			opts:     []EncodeOption{WithNestedTabular()},
+			expected: "[1]{\"a.b\",c}:\n  1,2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Encode(tt.input, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		input := []Repo{
+			{ID: 1, Owner: Owner{ID: 7, Name: "ada"}, Tags: []string{"go", "a,b"}},
+			{ID: 2, Owner: Owner{ID: 8, Name: "bob"}, Tags: []string{}},
+		}
+		encoded, err := Encode(input, WithNestedTabular(), WithDelimiter("\t"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var decoded []struct {
+			ID    int `json:"id"`
+			Owner struct {
+				ID  int    `json:"id"`
+				Who string `json:"who"`
+			} `json:"owner"`
+			Tags []string `json:"tags"`
+		}
+		if err := Unmarshal([]byte(encoded), &decoded, WithPathExpansion()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(decoded) != 2 || decoded[0].Owner.Who != "ada" || decoded[1].Owner.ID != 8 ||
+			!reflect.DeepEqual(decoded[0].Tags, input[0].Tags) || len(decoded[1].Tags) != 0 {
+			t.Errorf("unexpected result %+v from\n%s", decoded, encoded)
+		}
+	})
+
+	t.Run("round trip with dotted keys", func(t *testing.T) {
+		inputs := []interface{}{
+			[]interface{}{
+				map[string]interface{}{"a.b": 1.0, "a": map[string]interface{}{"c": 2.0}},
+				map[string]interface{}{"a.b": 3.0, "a": map[string]interface{}{"c": 4.0}},
+			},
+			[]interface{}{
+				map[string]interface{}{"a.b": 1.0, "c": map[string]interface{}{"d": 2.0}},
+			},
+			map[string]interface{}{"x.y": 1.0, "x": map[string]interface{}{"z": 2.0}},
+		}
+		for _, input := range inputs {
+			encoded, err := Encode(input, WithNestedTabular())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			decoded, err := Decode(encoded, WithPathExpansion())
+			if err != nil {
+				t.Fatalf("unexpected error: %v\n%s", err, encoded)
+			}
+			if !reflect.DeepEqual(decoded, input) {
+				t.Errorf("expected %#v, got %#v\n%s", input, decoded, encoded)
+			}
+		}
+	})
+}
+
+func TestEncodeDirectMatchesNormalized(t *testing.T) {
+	type Tags struct {
+		Name  string   `toon:"name,quote"`
+		Items []string `toon:"items,list"`
+		Code  int      `json:"code,string"`
+		Desc  string   `toon:"description,header=desc"`
+	}
+	type Row struct {
+		ID    int64    `json:"id"`
+		Score *float64 `json:"score"`
+		When  time.Time
+		Label uuid `json:"label"`
+	}
+	type Sparse struct {
+		ID   int    `json:"id"`
+		Note string `json:"note,omitempty"`
+	}
+	type Audited struct {
+		ID int `json:"id"`
+		*audit
+	}
+	type Nested struct {
+		Rows    []Row             `json:"rows"`
+		Ptrs    []*Row            `json:"ptrs"`
+		Sparse  []Sparse          `json:"sparse"`
+		Tagged  []Tags            `json:"tagged"`
+		Matrix  [][]int           `json:"matrix"`
+		Meta    map[string]string `json:"meta"`
+		Any     interface{}       `json:"any"`
+		Inner   *Nested           `json:"inner,omitempty"`
+		Bytes   []byte            `json:"bytes"`
+		Empty   struct{}          `json:"empty"`
+		Status  status            `json:"status"`
+		Order   BaseEntity
+		Numbers [3]float32 `json:"numbers"`
+	}
+
+	score := 9.5
+	row := Row{ID: 1, Score: &score, When: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), Label: uuid{1, 2, 3, 4}}
+	nested := &Nested{
+		Rows:    []Row{row, {ID: 2}},
+		Ptrs:    []*Row{&row, nil},
+		Sparse:  []Sparse{{ID: 1, Note: "a, b"}, {ID: 2}},
+		Tagged:  []Tags{{Name: "x", Items: []string{"a"}, Code: 7, Desc: "d"}},
+		Matrix:  [][]int{{1, 2}, {3}},
+		Meta:    map[string]string{"b": "2", "a": "1"},
+		Any:     []interface{}{1, "two", map[string]interface{}{"three": 3}},
+		Inner:   &Nested{Status: 1, Ptrs: []*Row{&row}},
+		Bytes:   []byte("hi"),
+		Status:  2,
+		Numbers: [3]float32{1.5, -0, 3},
+	}
+
+	inputs := []interface{}{
+		nil,
+		"text",
+		42,
+		nested,
+		*nested,
+		[]Row{row, row},
+		[]*Row{&row, &row},
+		[]Tags{{Name: "x", Code: 1, Desc: "y"}},
+		[]Sparse{{ID: 1}, {ID: 2}},
+		[]Sparse{{ID: 1, Note: "x"}, {ID: 2, Note: "y"}},
+		[]Audited{{ID: 1}, {ID: 2, audit: &audit{UpdatedBy: "ada"}}},
+		[]Audited{{ID: 1, audit: &audit{}}, {ID: 2, audit: &audit{UpdatedBy: "ada"}}},
+		[]struct{}{{}, {}},
+		[]struct{ J json.Number }{{}, {J: "-0"}, {J: "1e3"}},
+		[]interface{}{row, 1},
+		map[string]interface{}{"rows": []Row{row}},
+	}
+	optionSets := [][]EncodeOption{
+		nil,
+		{WithDelimiter("\t"), WithLengthMarker()},
+		{WithDelimiter("|"), WithIndent(4)},
+		{WithKeyOrder(KeyOrderAlphabetical)},
+		{WithKeyCompare(func(a, b string) int { return len(a) - len(b) })},
+		{WithSparseTabular(SparseEmpty)},
+		{WithSparseTabular(SparseNull), WithDelimiter("\t")},
+	}
+
+	for i, input := range inputs {
+		for j, opts := range optionSets {
+			options := resolveOptions(opts)
+
+			writer := NewLineWriter(options.Indent)
+			directErr := encodeDirect(input, writer, options)
+
+			normalized, err := normalizeValue(input, options)
+			if err != nil || directErr != nil {
+				t.Fatalf("input %d, options %d: unexpected errors %v, %v", i, j, directErr, err)
+			}
+			expected := encodeValue(normalized, options)
+			if got := writer.String(); got != expected {
+				t.Errorf("input %d, options %d: expected:\n%s\n\ngot:\n%s", i, j, expected, got)
+			}
+		}
+	}
+}
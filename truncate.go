@@ -0,0 +1,277 @@
+package gotoon
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// TruncationMarker is appended to strings shortened by WithMaxStringLen or
+// WithTokenBudget
+const TruncationMarker = "…"
+
+// TruncationKind identifies what a Truncation shortened
+type TruncationKind int
+
+const (
+	// ArrayTruncation is an array whose trailing items were dropped
+	ArrayTruncation TruncationKind = iota
+
+	// StringTruncation is a string whose trailing characters were dropped
+	StringTruncation
+)
+
+// Truncation describes a single array or string shortened during encoding
+type Truncation struct {
+	// Kind is what was shortened
+	Kind TruncationKind
+
+	// Path locates the value, such as users or users[3].bio
+	Path string
+
+	// Length is the original number of items or characters
+	Length int
+
+	// Kept is the number of items or characters that were encoded
+	Kept int
+}
+
+// EncodeResult is the outcome of EncodeWithResult
+type EncodeResult struct {
+	// Output is the TOON encoding
+	Output string
+
+	// Tokens is the token count of Output
+	Tokens int
+
+	// Truncations lists the arrays and strings that were shortened, in
+	// document order
+	Truncations []Truncation
+
+	// tree is the truncated normalized tree that Output encodes, set by
+	// truncateTree
+	tree interface{}
+}
+
+// TokenBudgetError is returned when a value cannot fit in the token budget
+// even with every array emptied and every string truncated
+type TokenBudgetError struct {
+	Budget int
+	Tokens int
+}
+
+// Error implements the error interface
+func (e *TokenBudgetError) Error() string {
+	return fmt.Sprintf("toon: output needs at least %d tokens, exceeding the budget of %d", e.Tokens, e.Budget)
+}
+
+// EncodeWithResult encodes a value like Encode and also reports the token
+// count of the output and what was dropped to respect WithMaxArrayItems,
+// WithMaxStringLen and WithTokenBudget.
+//
+// Truncated arrays keep their leading items and their [N] header states the
+// number of items actually encoded, so the output stays valid TOON. Truncated
+// strings keep their leading characters followed by TruncationMarker.
+//
+// With a token budget, arrays are first shortened to the largest common
+// number of items that fits, counted with the tokenizer set by WithTokenizer
+// or DefaultTokenizer. If the output is still too large with every array
+// emptied, strings are shortened as well, and if even that is not enough a
+// *TokenBudgetError is returned.
+//
+// Example:
+//
+//	result, err := gotoon.EncodeWithResult(rows, gotoon.WithTokenBudget(2000))
+//	for _, t := range result.Truncations {
+//		log.Printf("%s: kept %d of %d", t.Path, t.Kept, t.Length)
+//	}
+func EncodeWithResult(v interface{}, opts ...EncodeOption) (*EncodeResult, error) {
+	return encodeWithResult(v, resolveOptions(opts))
+}
+
+// encodeWithResult encodes v from its normalized tree, applying the
+// truncation limits of the options
+func encodeWithResult(v interface{}, opts *EncodeOptions) (*EncodeResult, error) {
+	if !opts.truncates() {
+		writer := NewLineWriter(opts.Indent)
+		if err := encodeDirect(v, writer, opts); err != nil {
+			return nil, err
+		}
+		output := writer.String()
+		return &EncodeResult{Output: output, Tokens: opts.tokenizer().CountTokens(output)}, nil
+	}
+
+	normalized, err := normalizeValue(v, opts)
+	if err != nil {
+		return nil, err
+	}
+	return truncateTree(normalized, opts)
+}
+
+// truncateTree encodes a normalized tree, shortening its arrays and strings
+// to respect the truncation limits of the options
+func truncateTree(normalized interface{}, opts *EncodeOptions) (*EncodeResult, error) {
+	// render encodes the tree with at most maxItems items per array, or all
+	// of them when maxItems is negative, and at most maxRunes characters
+	// per string, or all of them when maxRunes is zero
+	render := func(maxItems, maxRunes int) *EncodeResult {
+		t := &truncator{maxItems: maxItems, maxRunes: maxRunes}
+		truncated := t.value(normalized, "")
+		writer := NewLineWriter(opts.Indent)
+		encodeValueTo(truncated, writer, opts)
+		output := writer.String()
+		return &EncodeResult{
+			Output:      output,
+			Tokens:      opts.tokenizer().CountTokens(output),
+			Truncations: t.truncations,
+			tree:        truncated,
+		}
+	}
+
+	maxItems := opts.MaxArrayItems
+	if maxItems <= 0 {
+		maxItems = -1
+	}
+	result := render(maxItems, opts.MaxStringLen)
+	if opts.TokenBudget <= 0 || result.Tokens <= opts.TokenBudget {
+		return result, nil
+	}
+
+	// Find the largest number of array items that fits, then the largest
+	// string length if not even empty arrays fit
+	longestArray, longestString := measureTree(normalized)
+	if maxItems >= 0 {
+		longestArray = min(longestArray, maxItems)
+	}
+	if opts.MaxStringLen > 0 {
+		longestString = min(longestString, opts.MaxStringLen)
+	}
+	fits := func(r *EncodeResult) bool { return r.Tokens <= opts.TokenBudget }
+
+	if best := searchLimit(0, longestArray-1, func(n int) *EncodeResult {
+		return render(n, opts.MaxStringLen)
+	}, fits); best != nil {
+		return best, nil
+	}
+	if best := searchLimit(1, longestString-1, func(n int) *EncodeResult {
+		return render(0, n)
+	}, fits); best != nil {
+		return best, nil
+	}
+	return nil, &TokenBudgetError{Budget: opts.TokenBudget, Tokens: render(0, 1).Tokens}
+}
+
+// searchLimit returns the result for the largest limit between low and high
+// that fits, or nil if none does. Results grow with the limit, so the limit
+// is found by binary search.
+func searchLimit(low, high int, render func(int) *EncodeResult, fits func(*EncodeResult) bool) *EncodeResult {
+	var best *EncodeResult
+	for low <= high {
+		mid := (low + high) / 2
+		result := render(mid)
+		if fits(result) {
+			best = result
+			low = mid + 1
+		} else {
+			high = mid - 1
+		}
+	}
+	return best
+}
+
+// truncates reports whether the options limit the size of the output
+func (opts *EncodeOptions) truncates() bool {
+	return opts.TokenBudget > 0 || opts.MaxArrayItems > 0 || opts.MaxStringLen > 0
+}
+
+// truncator copies a normalized tree, shortening arrays and strings and
+// recording what it dropped
+type truncator struct {
+	maxItems    int
+	maxRunes    int
+	truncations []Truncation
+}
+
+// value returns a truncated copy of a normalized value at the given path
+func (t *truncator) value(value interface{}, path string) interface{} {
+	switch v := value.(type) {
+	case *object:
+		copied := newObject(v.len())
+		for _, key := range v.keys {
+			copied.set(key, t.value(v.values[key], keyPath(path, key)))
+		}
+		copied.headers = v.headers
+		return copied
+
+	case []interface{}:
+		return t.array(v, path)
+
+	case listArray:
+		return listArray(t.array(v, path))
+
+	case string:
+		return t.string(v, path)
+
+	case quotedString:
+		return quotedString(t.string(string(v), path))
+	}
+	return value
+}
+
+// array returns a truncated copy of an array
+func (t *truncator) array(arr []interface{}, path string) []interface{} {
+	kept := len(arr)
+	if t.maxItems >= 0 && kept > t.maxItems {
+		kept = t.maxItems
+		t.truncations = append(t.truncations, Truncation{Kind: ArrayTruncation, Path: path, Length: len(arr), Kept: kept})
+	}
+
+	copied := make([]interface{}, kept)
+	for i := range copied {
+		copied[i] = t.value(arr[i], indexPath(path, i))
+	}
+	return copied
+}
+
+// string returns s shortened to the maximum number of characters
+func (t *truncator) string(s string, path string) string {
+	if t.maxRunes <= 0 {
+		return s
+	}
+	length := utf8.RuneCountInString(s)
+	if length <= t.maxRunes {
+		return s
+	}
+
+	t.truncations = append(t.truncations, Truncation{Kind: StringTruncation, Path: path, Length: length, Kept: t.maxRunes})
+	return string([]rune(s)[:t.maxRunes]) + TruncationMarker
+}
+
+// measureTree returns the length of the longest array and the longest
+// string in a normalized value, in items and characters
+func measureTree(value interface{}) (longestArray, longestString int) {
+	var walk func(value interface{})
+	walkArray := func(arr []interface{}) {
+		longestArray = max(longestArray, len(arr))
+		for _, item := range arr {
+			walk(item)
+		}
+	}
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case *object:
+			for _, key := range v.keys {
+				walk(v.values[key])
+			}
+		case []interface{}:
+			walkArray(v)
+		case listArray:
+			walkArray(v)
+		case string:
+			longestString = max(longestString, utf8.RuneCountInString(v))
+		case quotedString:
+			longestString = max(longestString, utf8.RuneCountInString(string(v)))
+		}
+	}
+	walk(value)
+	return longestArray, longestString
+}
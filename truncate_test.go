@@ -0,0 +1,126 @@
+package gotoon
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeTruncation(t *testing.T) {
+	type User struct {
+		ID  int    `json:"id"`
+		Bio string `json:"bio"`
+	}
+	users := []User{
+		{ID: 1, Bio: "short"},
+		{ID: 2, Bio: "a rather long biography"},
+		{ID: 3, Bio: "x"},
+	}
+	data := map[string]interface{}{"users": users, "tags": []string{"a", "b", "c", "d"}}
+
+	tests := []struct {
+		name        string
+		opts        []EncodeOption
+		expected    string
+		truncations []Truncation
+	}{
+		{
+			name:     "max array items",
+			opts:     []EncodeOption{WithMaxArrayItems(2)},
+			expected: "tags[2]: a,b\nusers[2]{id,bio}:\n  1,short\n  2,a rather long biography",
+			truncations: []Truncation{
+				{Kind: ArrayTruncation, Path: "tags", Length: 4, Kept: 2},
+				{Kind: ArrayTruncation, Path: "users", Length: 3, Kept: 2},
+			},
+		},
+		{
+			name:     "max string length",
+			opts:     []EncodeOption{WithMaxStringLen(8)},
+			expected: "tags[4]: a,b,c,d\nusers[3]{id,bio}:\n  1,short\n  2,a rather…\n  3,x",
+			truncations: []Truncation{
+				{Kind: StringTruncation, Path: "users[1].bio", Length: 23, Kept: 8},
+			},
+		},
+		{
+			name:     "token budget",
+			opts:     []EncodeOption{WithTokenBudget(50), WithTokenizer(byteTokenizer{})},
+			expected: "tags[1]: a\nusers[1]{id,bio}:\n  1,short",
+			truncations: []Truncation{
+				{Kind: ArrayTruncation, Path: "tags", Length: 4, Kept: 1},
+				{Kind: ArrayTruncation, Path: "users", Length: 3, Kept: 1},
+			},
+		},
+		{
+			name:     "token budget within limits",
+			opts:     []EncodeOption{WithTokenBudget(1000), WithMaxArrayItems(3), WithTokenizer(byteTokenizer{})},
+			expected: "tags[3]: a,b,c\nusers[3]{id,bio}:\n  1,short\n  2,a rather long biography\n  3,x",
+			truncations: []Truncation{
+				{Kind: ArrayTruncation, Path: "tags", Length: 4, Kept: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := EncodeWithResult(data, tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Output != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, result.Output)
+			}
+			if !reflect.DeepEqual(result.Truncations, tt.truncations) {
+				t.Errorf("expected truncations %+v, got %+v", tt.truncations, result.Truncations)
+			}
+
+			encoded, err := Encode(data, tt.opts...)
+			if err != nil || encoded != result.Output {
+				t.Errorf("expected Encode to match, got %q, %v", encoded, err)
+			}
+			if _, err := Decode(encoded); err != nil {
+				t.Errorf("truncated output does not decode: %v", err)
+			}
+		})
+	}
+
+	t.Run("strings when arrays are not enough", func(t *testing.T) {
+		input := map[string]interface{}{"title": strings.Repeat("word ", 20), "items": []int{1, 2, 3}}
+		result, err := EncodeWithResult(input, WithTokenBudget(30), WithTokenizer(byteTokenizer{}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Tokens > 30 || len(result.Truncations) != 2 || result.Truncations[1].Kind != StringTruncation {
+			t.Errorf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("budget too small", func(t *testing.T) {
+		_, err := Encode(map[string]interface{}{"id": 1, "name": "Ada"}, WithTokenBudget(3), WithTokenizer(byteTokenizer{}))
+		var budgetErr *TokenBudgetError
+		if !errors.As(err, &budgetErr) || budgetErr.Budget != 3 || budgetErr.Tokens != len("id: 1\nname: A…") {
+			t.Errorf("expected *TokenBudgetError, got %v", err)
+		}
+	})
+
+	t.Run("without limits", func(t *testing.T) {
+		result, err := EncodeWithResult(users)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		encoded, _ := Encode(users)
+		if result.Output != encoded || result.Tokens != CountTokens(encoded) || result.Truncations != nil {
+			t.Errorf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("stream encoder", func(t *testing.T) {
+		var sb strings.Builder
+		if err := NewEncoder(&sb, WithMaxArrayItems(1)).Encode([]int{1, 2}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sb.String() != "[1]: 1\n" {
+			t.Errorf("unexpected output %q", sb.String())
+		}
+	})
+}
@@ -13,8 +13,94 @@ type EncodeOptions struct {
 	// LengthMarker when true adds "#" prefix to array lengths (e.g., [#3] instead of [3])
 	// Default: false
 	LengthMarker bool
+
+	// KeyOrder controls the order of object keys
+	// Default: KeyOrderDeclaration
+	KeyOrder KeyOrder
+
+	// KeyCompare, when set, orders object keys with a custom comparison
+	// function and takes precedence over KeyOrder
+	KeyCompare func(a, b string) int
+
+	// Strict when true returns an error for values that cannot be
+	// represented in TOON instead of encoding them as null
+	// Default: true
+	Strict bool
+
+	// MaxDepth is the maximum number of nested arrays and objects; deeper
+	// values return an error. Zero or less disables the limit.
+	// Default: DefaultMaxDepth
+	MaxDepth int
+
+	// Sparse controls whether arrays of objects whose keys differ can still
+	// use tabular format, and how absent fields are written
+	// Default: SparseOff
+	Sparse SparseMode
+
+	// SparseThreshold is the largest share of absent cells, between 0 and
+	// 1, for which a sparse array still uses tabular format
+	// Default: DefaultSparseThreshold
+	SparseThreshold float64
+
+	// KeyFolding when true collapses chains of single-key objects into
+	// dotted keys (e.g., config.db.host: x)
+	// Default: false
+	KeyFolding bool
+
+	// NestedTabular when true lets tabular arrays flatten nested objects
+	// into dotted columns and hold arrays of primitives in cells
+	// Default: false
+	NestedTabular bool
+
+	// Tokenizer counts tokens for functions that measure encoded output
+	// Default: DefaultTokenizer
+	Tokenizer Tokenizer
+
+	// TokenBudget is the largest number of tokens the output may use;
+	// arrays and then strings are truncated to fit (0 means no budget)
+	// Default: 0
+	TokenBudget int
+
+	// MaxArrayItems is the largest number of items encoded per array
+	// (0 means no limit)
+	// Default: 0
+	MaxArrayItems int
+
+	// MaxStringLen is the largest number of characters encoded per string
+	// (0 means no limit)
+	// Default: 0
+	MaxStringLen int
 }
 
+// SparseMode controls tabular encoding of arrays of objects whose keys differ
+type SparseMode int
+
+const (
+	// SparseOff requires every object to have exactly the same keys for
+	// tabular format
+	SparseOff SparseMode = iota
+
+	// SparseEmpty uses the union of keys as columns and leaves absent
+	// fields as empty cells, which decode back to missing keys
+	SparseEmpty
+
+	// SparseNull uses the union of keys as columns and writes absent fields
+	// as null
+	SparseNull
+)
+
+// KeyOrder controls the order in which object keys are encoded
+type KeyOrder int
+
+const (
+	// KeyOrderDeclaration keeps struct fields in declaration order. Map keys
+	// have no declaration order and are sorted alphabetically.
+	KeyOrderDeclaration KeyOrder = iota
+
+	// KeyOrderAlphabetical sorts the keys of structs and maps alphabetically
+	KeyOrderAlphabetical
+)
+
 // EncodeOption is a function that modifies EncodeOptions
 type EncodeOption func(*EncodeOptions)
 
@@ -39,12 +125,162 @@ func WithLengthMarker() EncodeOption {
 	}
 }
 
+// WithKeyOrder sets the order of object keys
+func WithKeyOrder(order KeyOrder) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.KeyOrder = order
+	}
+}
+
+// WithKeyCompare orders object keys with a custom comparison function, which
+// returns a negative number when a sorts before b, zero when they are equal
+// and a positive number otherwise. Keys that compare equal keep their
+// declaration order.
+func WithKeyCompare(cmp func(a, b string) int) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.KeyCompare = cmp
+	}
+}
+
+// WithStrict controls whether values that cannot be represented in TOON,
+// such as functions, channels, NaN and maps with unsupported key types,
+// return an *UnsupportedTypeError or *UnsupportedValueError (the default) or
+// are silently encoded as null
+func WithStrict(strict bool) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.Strict = strict
+	}
+}
+
+// WithMaxDepth sets the maximum number of nested arrays and objects. Deeper
+// values return an *UnsupportedValueError, which protects the stack when
+// encoding deeply nested untrusted data. Zero or less disables the limit.
+func WithMaxDepth(n int) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.MaxDepth = n
+	}
+}
+
+// WithSparseTabular allows tabular format for arrays of objects whose keys
+// differ. The columns are the union of all keys and absent fields are
+// written as empty cells (SparseEmpty) or null (SparseNull).
+func WithSparseTabular(mode SparseMode) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.Sparse = mode
+	}
+}
+
+// WithSparseThreshold sets the largest share of absent cells, between 0 and
+// 1, for which a sparse array still uses tabular format. Sparser arrays use
+// list format.
+func WithSparseThreshold(threshold float64) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.SparseThreshold = threshold
+	}
+}
+
+// WithKeyFolding collapses chains of objects that each hold a single key into
+// one dotted key, so {"config": {"db": {"host": "x"}}} encodes as
+// "config.db.host: x". Only keys that are plain identifiers are folded, and
+// keys that already contain dots are quoted so they stay literal. Decode
+// with WithPathExpansion to restore the nesting.
+func WithKeyFolding() EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.KeyFolding = true
+	}
+}
+
+// WithNestedTabular extends tabular format to arrays of objects holding
+// nested objects and arrays of primitives. Nested objects become dotted
+// columns such as owner.name, and arrays of primitives become bracketed
+// cells such as [a,b]. Keys that already contain dots are quoted so they
+// stay literal. Decode with WithPathExpansion to restore the nested objects.
+func WithNestedTabular() EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.NestedTabular = true
+	}
+}
+
+// WithTokenizer sets the Tokenizer used by functions that measure encoded
+// output, such as Compare
+func WithTokenizer(t Tokenizer) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.Tokenizer = t
+	}
+}
+
+// WithTokenBudget truncates arrays, and strings if needed, so the output
+// fits in n tokens as counted by the configured Tokenizer. Use
+// EncodeWithResult to find out what was dropped.
+func WithTokenBudget(n int) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.TokenBudget = n
+	}
+}
+
+// WithMaxArrayItems encodes at most n items of each array; the array header
+// states the number of items kept
+func WithMaxArrayItems(n int) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.MaxArrayItems = n
+	}
+}
+
+// WithMaxStringLen encodes at most n characters of each string, followed by
+// TruncationMarker when the string was shortened
+func WithMaxStringLen(n int) EncodeOption {
+	return func(opts *EncodeOptions) {
+		opts.MaxStringLen = n
+	}
+}
+
+// tokenizer returns the configured Tokenizer or DefaultTokenizer
+func (opts *EncodeOptions) tokenizer() Tokenizer {
+	if opts.Tokenizer != nil {
+		return opts.Tokenizer
+	}
+	return DefaultTokenizer
+}
+
+// writesPaths reports whether the output may hold dotted key paths, which
+// WithPathExpansion splits into nested objects when decoding
+func (opts *EncodeOptions) writesPaths() bool {
+	return opts.KeyFolding || opts.NestedTabular
+}
+
+// DecodeOptions represents the options for decoding TOON documents
+type DecodeOptions struct {
+	// ExpandPaths when true splits unquoted dotted keys into nested objects
+	// (e.g., config.db.host: x becomes {"config": {"db": {"host": "x"}}})
+	// Default: false
+	ExpandPaths bool
+}
+
+// DecodeOption is a function that modifies DecodeOptions
+type DecodeOption func(*DecodeOptions)
+
+// WithPathExpansion splits unquoted keys made of dotted identifier segments
+// into nested objects, reversing WithKeyFolding. Objects reached through
+// the same path prefix are merged; a path that runs into a non-object value
+// returns a *SyntaxError. Quoted keys are always kept as they are.
+func WithPathExpansion() DecodeOption {
+	return func(opts *DecodeOptions) {
+		opts.ExpandPaths = true
+	}
+}
+
 // defaultOptions returns the default encoding options
 func defaultOptions() *EncodeOptions {
 	return &EncodeOptions{
 		Indent:       2,
 		Delimiter:    DefaultDelimiter,
 		LengthMarker: false,
+		KeyOrder:     KeyOrderDeclaration,
+		Strict:       true,
+		MaxDepth:     DefaultMaxDepth,
+
+		Sparse:          SparseOff,
+		SparseThreshold: DefaultSparseThreshold,
 	}
 }
 
@@ -56,3 +292,12 @@ func resolveOptions(opts []EncodeOption) *EncodeOptions {
 	}
 	return options
 }
+
+// resolveDecodeOptions applies decode options over the defaults
+func resolveDecodeOptions(opts []DecodeOption) *DecodeOptions {
+	options := &DecodeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
@@ -0,0 +1,405 @@
+package gotoon
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
+// The argument must be a non-nil pointer.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+// Error implements the error interface
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "toon: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return "toon: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "toon: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// UnmarshalTypeError describes a TOON value that cannot be stored in a Go
+// value of a specific type
+type UnmarshalTypeError struct {
+	// Value describes the TOON value, e.g. "string" or "number 1.5"
+	Value string
+
+	// Type is the Go type the value could not be assigned to
+	Type reflect.Type
+
+	// Path is the location of the value, e.g. "users[1].id"
+	Path string
+
+	// Err is the error returned by UnmarshalText, if any
+	Err error
+}
+
+// Error implements the error interface
+func (e *UnmarshalTypeError) Error() string {
+	msg := fmt.Sprintf("toon: cannot unmarshal %s into Go value of type %s", e.Value, e.Type)
+	if e.Path != "" {
+		msg += " at " + e.Path
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *UnmarshalTypeError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	float64Type         = reflect.TypeOf(0.0)
+)
+
+// assignValue stores a decoded value into dst
+func assignValue(dst reflect.Value, value interface{}, path string) error {
+	if value == nil {
+		switch dst.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), value, path)
+	}
+
+	// Types such as time.Time decode themselves from their string form, and
+	// math/big numbers from their exact decimal text
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+		u := dst.Addr().Interface().(encoding.TextUnmarshaler)
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case json.Number:
+			text = string(v)
+		default:
+			return typeError(value, dst.Type(), path)
+		}
+		if err := u.UnmarshalText([]byte(text)); err != nil {
+			typeErr := typeError(value, dst.Type(), path)
+			typeErr.Err = err
+			return typeErr
+		}
+		return nil
+	}
+
+	if dst.Type() == numberType {
+		n, ok := value.(json.Number)
+		if !ok {
+			return typeError(value, dst.Type(), path)
+		}
+		dst.SetString(string(n))
+		return nil
+	}
+
+	if dst.Kind() == reflect.Interface {
+		if dst.NumMethod() != 0 {
+			return typeError(value, dst.Type(), path)
+		}
+		generic, err := genericValue(value, path)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(generic))
+		return nil
+	}
+
+	switch v := value.(type) {
+	case bool:
+		if dst.Kind() != reflect.Bool {
+			return typeError(value, dst.Type(), path)
+		}
+		dst.SetBool(v)
+
+	case json.Number:
+		return assignNumber(dst, v, path)
+
+	case string:
+		if dst.Kind() != reflect.String {
+			return typeError(value, dst.Type(), path)
+		}
+		dst.SetString(v)
+
+	case []interface{}:
+		return assignArray(dst, v, path)
+
+	case *object:
+		return assignObject(dst, v, path)
+	}
+
+	return nil
+}
+
+// assignNumber stores a number literal into a numeric dst without losing
+// precision through float64
+func assignNumber(dst reflect.Value, n json.Number, path string) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(string(n), 10, dst.Type().Bits())
+		if err != nil {
+			return typeError(n, dst.Type(), path)
+		}
+		dst.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(string(n), 10, dst.Type().Bits())
+		if err != nil {
+			return typeError(n, dst.Type(), path)
+		}
+		dst.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(n), dst.Type().Bits())
+		if err != nil {
+			return typeError(n, dst.Type(), path)
+		}
+		dst.SetFloat(f)
+
+	default:
+		return typeError(n, dst.Type(), path)
+	}
+	return nil
+}
+
+// assignArray stores a decoded array into a slice or array dst
+func assignArray(dst reflect.Value, arr []interface{}, path string) error {
+	switch dst.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, item := range arr {
+			if err := assignValue(slice.Index(i), item, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+
+	case reflect.Array:
+		for i := 0; i < dst.Len(); i++ {
+			if i >= len(arr) {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+				continue
+			}
+			if err := assignValue(dst.Index(i), arr[i], indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return typeError(arr, dst.Type(), path)
+	}
+	return nil
+}
+
+// assignObject stores a decoded object into a struct or map dst
+func assignObject(dst reflect.Value, obj *object, path string) error {
+	switch dst.Kind() {
+	case reflect.Struct:
+		fields := cachedTypeFields(dst.Type())
+		for _, key := range obj.keys {
+			value := obj.values[key]
+			f, ok := lookupField(fields, key)
+			if !ok {
+				// Unknown keys are ignored
+				continue
+			}
+			fieldPath := keyPath(path, key)
+			fieldValue, err := fieldByIndexAlloc(dst, f.index)
+			if err != nil {
+				return err
+			}
+			if f.asString {
+				if err := assignStringField(fieldValue, value, fieldPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := assignValue(fieldValue, value, fieldPath); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		t := dst.Type()
+		if !isValidMapKey(t.Key()) && !reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) {
+			return typeError(obj, t, path)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(t, obj.len()))
+		}
+		for _, key := range obj.keys {
+			value := obj.values[key]
+			elemPath := keyPath(path, key)
+			mapKey, err := mapKeyValue(key, t.Key(), elemPath)
+			if err != nil {
+				return err
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := assignValue(elem, value, elemPath); err != nil {
+				return err
+			}
+			dst.SetMapIndex(mapKey, elem)
+		}
+
+	default:
+		return typeError(obj, dst.Type(), path)
+	}
+	return nil
+}
+
+// mapKeyValue converts an object key back to a map key of type t, following
+// the same rules as encoding/json: encoding.TextUnmarshaler first, then
+// string kinds, then integers parsed from their decimal form
+func mapKeyValue(key string, t reflect.Type, path string) (reflect.Value, error) {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		k := reflect.New(t)
+		if err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			keyErr := keyError(key, t, path)
+			keyErr.Err = err
+			return reflect.Value{}, keyErr
+		}
+		return k.Elem(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(key).Convert(t), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(key, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, keyError(key, t, path)
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(key, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, keyError(key, t, path)
+		}
+		return reflect.ValueOf(u).Convert(t), nil
+	}
+	return reflect.Value{}, keyError(key, t, path)
+}
+
+// assignStringField stores a value encoded with the json "string" option,
+// parsing the scalar back out of its string form
+func assignStringField(dst reflect.Value, value interface{}, path string) error {
+	s, ok := value.(string)
+	if !ok {
+		return assignValue(dst, value, path)
+	}
+
+	target := dst
+	if target.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+
+	if target.Kind() == reflect.String {
+		var unquoted string
+		if err := json.Unmarshal([]byte(s), &unquoted); err != nil {
+			return typeError(value, dst.Type(), path)
+		}
+		target.SetString(unquoted)
+		return nil
+	}
+
+	scalar, err := decodePrimitive(s, true)
+	if err != nil {
+		return typeError(value, dst.Type(), path)
+	}
+	return assignValue(target, scalar, path)
+}
+
+// genericValue converts a decoded tree to the shapes returned by Decode,
+// failing on numbers out of the float64 range
+func genericValue(value interface{}, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, typeError(v, float64Type, path)
+		}
+		// Normalize -0 to 0
+		if f == 0 {
+			return 0.0, nil
+		}
+		return f, nil
+	case []interface{}:
+		for i, item := range v {
+			generic, err := genericValue(item, indexPath(path, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = generic
+		}
+	case *object:
+		m := make(map[string]interface{}, v.len())
+		for _, key := range v.keys {
+			generic, err := genericValue(v.values[key], keyPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			m[key] = generic
+		}
+		return m, nil
+	}
+	return value, nil
+}
+
+// typeError builds an UnmarshalTypeError for a decoded value
+func typeError(value interface{}, t reflect.Type, path string) *UnmarshalTypeError {
+	var desc string
+	switch v := value.(type) {
+	case bool:
+		desc = "bool"
+	case json.Number:
+		desc = "number " + string(v)
+	case string:
+		desc = "string"
+	case []interface{}:
+		desc = "array"
+	case *object:
+		desc = "object"
+	}
+	return &UnmarshalTypeError{Value: desc, Type: t, Path: path}
+}
+
+// keyError returns an *UnmarshalTypeError for an object key that cannot be
+// converted to a map key of type t
+func keyError(key string, t reflect.Type, path string) *UnmarshalTypeError {
+	return &UnmarshalTypeError{Value: "key " + strconv.Quote(key), Type: t, Path: path}
+}
+
+// keyPath appends an object key to a value path
+func keyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexPath appends an array index to a value path
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
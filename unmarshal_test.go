@@ -0,0 +1,298 @@
+package gotoon
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalStruct(t *testing.T) {
+	type Profile struct {
+		Theme string `json:"theme"`
+	}
+	type User struct {
+		ID      int64     `json:"id"`
+		Name    string    `json:"name"`
+		Score   float32   `json:"score"`
+		Active  bool      `json:"active"`
+		Tags    []string  `json:"tags"`
+		Profile *Profile  `json:"profile"`
+		Created time.Time `json:"created"`
+		Extra   map[string]interface{}
+	}
+
+	input := "id: 9007199254740993\nname: Ada\nscore: 1.5\nactive: true\ntags[2]: a,b\n" +
+		"profile:\n  theme: dark\ncreated: \"2025-01-15T10:30:00Z\"\nextra:\n  n: 2\n  list[1]: x\nunknown: 1"
+
+	var user User
+	if err := Unmarshal([]byte(input), &user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := User{
+		ID:      9007199254740993,
+		Name:    "Ada",
+		Score:   1.5,
+		Active:  true,
+		Tags:    []string{"a", "b"},
+		Profile: &Profile{Theme: "dark"},
+		Created: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Extra:   map[string]interface{}{"n": 2.0, "list": []interface{}{"x"}},
+	}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("expected:\n%#v\n\ngot:\n%#v", expected, user)
+	}
+}
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	type Item struct {
+		SKU   string  `json:"sku"`
+		Qty   uint64  `json:"qty"`
+		Price float64 `json:"price"`
+	}
+	type Order struct {
+		ID    string   `json:"id"`
+		Items []Item   `json:"items"`
+		Notes []string `json:"notes"`
+		Dims  [3]int   `json:"dims"`
+	}
+
+	order := Order{
+		ID: "ORD-1",
+		Items: []Item{
+			{SKU: "A1", Qty: math.MaxUint64, Price: 9.99},
+			{SKU: "B2", Qty: 1, Price: 14.5},
+		},
+		Notes: []string{"fragile, handle with care", "true"},
+		Dims:  [3]int{1, 2, 3},
+	}
+
+	encoded := "id: ORD-1\nitems[2]{sku,qty,price}:\n  A1,18446744073709551615,9.99\n  B2,1,14.5\n" +
+		"notes[2]: \"fragile, handle with care\",\"true\"\ndims[3]: 1,2,3"
+
+	var decoded Order
+	if err := Unmarshal([]byte(encoded), &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, order) {
+		t.Errorf("expected:\n%#v\n\ngot:\n%#v", order, decoded)
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	var value interface{}
+	if err := Unmarshal([]byte("a: 1\nb[2]: x,2"), &value); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"a": 1.0, "b": []interface{}{"x", 2.0}}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %#v, got %#v", expected, value)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	t.Run("non-pointer", func(t *testing.T) {
+		var v struct{}
+		var target *InvalidUnmarshalError
+		if err := Unmarshal([]byte("a: 1"), v); !errors.As(err, &target) {
+			t.Errorf("expected *InvalidUnmarshalError, got %v", err)
+		}
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		var v struct {
+			Users []struct {
+				ID int8 `json:"id"`
+			} `json:"users"`
+		}
+		err := Unmarshal([]byte("users[2]{id}:\n  1\n  300"), &v)
+		var target *UnmarshalTypeError
+		if !errors.As(err, &target) {
+			t.Fatalf("expected *UnmarshalTypeError, got %v", err)
+		}
+		if target.Path != "users[1].id" || target.Value != "number 300" {
+			t.Errorf("unexpected error details: %v", err)
+		}
+	})
+
+	t.Run("float out of range", func(t *testing.T) {
+		var v interface{}
+		err := Unmarshal([]byte("a:\n  b[2]: 1,1e400"), &v)
+		var target *UnmarshalTypeError
+		if !errors.As(err, &target) {
+			t.Fatalf("expected *UnmarshalTypeError, got %v", err)
+		}
+		if target.Path != "a.b[1]" || target.Value != "number 1e400" {
+			t.Errorf("unexpected error details: %v", err)
+		}
+	})
+
+	t.Run("UnmarshalText error", func(t *testing.T) {
+		var v struct {
+			Levels []level `json:"levels"`
+		}
+		err := Unmarshal([]byte("levels[2]: low,medium"), &v)
+		var target *UnmarshalTypeError
+		if !errors.As(err, &target) {
+			t.Fatalf("expected *UnmarshalTypeError, got %v", err)
+		}
+		if target.Path != "levels[1]" || target.Err == nil {
+			t.Errorf("unexpected error details: %v", err)
+		}
+
+		var keys map[level]int
+		if err := Unmarshal([]byte("medium: 1"), &keys); !errors.As(err, &target) || target.Err == nil {
+			t.Errorf("expected *UnmarshalTypeError wrapping the UnmarshalText error, got %v", err)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		var v map[string]interface{}
+		var target *SyntaxError
+		if err := Unmarshal([]byte("tags[2]: a"), &v); !errors.As(err, &target) {
+			t.Errorf("expected *SyntaxError, got %v", err)
+		}
+	})
+}
+
+func TestUnmarshalStructTags(t *testing.T) {
+	type Tagged struct {
+		Name    string `json:"name,omitempty"`
+		ID      int64  `json:"id,string"`
+		Flag    *bool  `json:"flag,string"`
+		Label   string `json:"label,string"`
+		Skipped string `json:"-"`
+		Dash    string `json:"-,"`
+	}
+
+	input := "name: Ada\nid: \"42\"\nflag: \"true\"\nlabel: \"\\\"x\\\"\"\nSkipped: no\n\"-\": dash"
+
+	var v Tagged
+	if err := Unmarshal([]byte(input), &v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Name != "Ada" || v.ID != 42 || v.Flag == nil || !*v.Flag || v.Label != "x" || v.Skipped != "" || v.Dash != "dash" {
+		t.Errorf("unexpected result: %+v", v)
+	}
+}
+
+func TestUnmarshalToonTags(t *testing.T) {
+	type Item struct {
+		ID          int    `json:"id"`
+		Description string `json:"description" toon:"description,header=desc"`
+		Secret      string `toon:"-"`
+		Renamed     string `json:"json_name" toon:"toon_name"`
+	}
+
+	var items []Item
+	input := "[2]{id,desc,toon_name,Secret}:\n  1,first,a,x\n  2,second,b,y"
+	if err := Unmarshal([]byte(input), &items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Item{
+		{ID: 1, Description: "first", Renamed: "a"},
+		{ID: 2, Description: "second", Renamed: "b"},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("expected %+v, got %+v", expected, items)
+	}
+}
+
+func TestUnmarshalNumbers(t *testing.T) {
+	var v struct {
+		Big    *big.Int    `json:"big"`
+		Float  big.Float   `json:"float"`
+		Rat    *big.Rat    `json:"rat"`
+		Number json.Number `json:"number"`
+	}
+	input := "big: 123456789012345678901234567890\nfloat: 2.5\nrat: 1/3\nnumber: 12345678901234567890.5"
+	if err := Unmarshal([]byte(input), &v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Big.String() != "123456789012345678901234567890" || v.Float.String() != "2.5" ||
+		v.Rat.String() != "1/3" || v.Number != "12345678901234567890.5" {
+		t.Errorf("unexpected result: %v %v %v %v", v.Big, &v.Float, v.Rat, v.Number)
+	}
+
+	var ts struct {
+		Created time.Time `json:"created"`
+	}
+	var target *UnmarshalTypeError
+	if err := Unmarshal([]byte("created: 12"), &ts); !errors.As(err, &target) {
+		t.Errorf("expected *UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestUnmarshalMapKeys(t *testing.T) {
+	type Stats struct {
+		Count int `json:"count"`
+	}
+
+	ints := map[int64]string{-1: "z", 9007199254740993: "big"}
+	encoded, err := Encode(ints)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decodedInts map[int64]string
+	if err := Unmarshal([]byte(encoded), &decodedInts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decodedInts, ints) {
+		t.Errorf("expected %v, got %v", ints, decodedInts)
+	}
+
+	levels := map[level]Stats{0: {Count: 5}, 1: {Count: 3}}
+	encoded, err = Encode(levels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decodedLevels map[level]Stats
+	if err := Unmarshal([]byte(encoded), &decodedLevels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decodedLevels, levels) {
+		t.Errorf("expected %v, got %v", levels, decodedLevels)
+	}
+
+	var bad map[uint8]string
+	var target *UnmarshalTypeError
+	if err := Unmarshal([]byte("\"300\": x"), &bad); !errors.As(err, &target) {
+		t.Errorf("expected *UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	type Audit struct {
+		UpdatedBy string `json:"updated_by"`
+	}
+	type Order struct {
+		BaseEntity
+		*Audit
+		Total float64 `json:"total"`
+	}
+
+	var order Order
+	input := "id: 7\ncreated: today\nupdated_by: ada\ntotal: 2.5"
+	if err := Unmarshal([]byte(input), &order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Order{
+		BaseEntity: BaseEntity{ID: 7, Created: "today"},
+		Audit:      &Audit{UpdatedBy: "ada"},
+		Total:      2.5,
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %+v, got %+v", expected, order)
+	}
+
+	var private struct {
+		*audit
+	}
+	if err := Unmarshal([]byte("updated_by: ada"), &private); err == nil {
+		t.Error("expected error for embedded pointer to unexported struct")
+	}
+}
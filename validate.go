@@ -0,0 +1,255 @@
+package gotoon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostic describes a problem found by Validate
+type Diagnostic struct {
+	// Line is the 1-based line number of the problem
+	Line int
+
+	// Column is the 1-based byte offset of the problem within the line
+	Column int
+
+	// Msg describes the problem
+	Msg string
+}
+
+// String returns the diagnostic as "line:column: message"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Msg)
+}
+
+// Validate checks a TOON document and reports every problem it finds, in
+// order of position, or nil if the document is valid:
+//   - Arrays whose declared [N] length differs from the number of inline
+//     values, tabular rows or list items
+//   - Tabular rows whose number of cells differs from the {fields} header
+//   - Indentation with tabs, that is not a multiple of the document's
+//     indentation size, or that is inconsistent within an array
+//   - Unterminated quoted strings and invalid escape sequences
+//
+// Unlike Decode, Validate keeps going after length, field count, quoting
+// and indentation problems. Other structural errors, such as a line that is
+// neither a key nor a list item where one is expected, are reported and end
+// the check, since the lines after them cannot be interpreted reliably.
+//
+// Example:
+//
+//	if diags := gotoon.Validate(output); len(diags) > 0 {
+//		for _, d := range diags {
+//			log.Printf("line %d, column %d: %s", d.Line, d.Column, d.Msg)
+//		}
+//		return errors.New("model returned malformed TOON")
+//	}
+func Validate(data []byte) []Diagnostic {
+	d := &diagnostics{quoteErrors: make(map[int]bool)}
+	rawLines := strings.Split(string(data), Newline)
+
+	// Check quoting first, so that values spoiled by a quoting error are
+	// not reported a second time by the parser
+	quotes := &quoteChecker{d: d}
+	for _, raw := range rawLines {
+		if strings.TrimSpace(raw) != "" {
+			quotes.lines++
+		}
+	}
+	for i, raw := range rawLines {
+		quotes.check(i+1, strings.TrimSuffix(raw, CarriageReturn))
+	}
+
+	var tracker indentTracker
+	var lines []line
+	for i, raw := range rawLines {
+		indent, text, err := scanLine(raw)
+		if err != nil {
+			// Leave out lines indented with tabs
+			d.add(i+1, len(raw)-len(strings.TrimLeft(raw, Space))+1, err.Error())
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		depth, err := tracker.depth(indent)
+		if err != nil {
+			// Continue at the enclosing depth
+			d.add(i+1, indent+1, err.Error())
+			depth = indent / tracker.size
+		}
+		lines = append(lines, line{num: i + 1, depth: depth, indent: indent, text: text})
+	}
+
+	p := &parser{lines: lines, useNumber: true, diagnostics: d}
+	if _, err := p.parseDocument(); err != nil {
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) && !d.quoteErrors[syntaxErr.Line] {
+			column := 1
+			for _, l := range lines {
+				if l.num == syntaxErr.Line {
+					column = l.indent + 1
+				}
+			}
+			d.add(syntaxErr.Line, column, syntaxErr.Msg)
+		}
+	}
+
+	sort.SliceStable(d.list, func(i, j int) bool {
+		if d.list[i].Line != d.list[j].Line {
+			return d.list[i].Line < d.list[j].Line
+		}
+		return d.list[i].Column < d.list[j].Column
+	})
+	return d.list
+}
+
+// diagnostics collects the problems found by Validate
+type diagnostics struct {
+	list []Diagnostic
+
+	// quoteErrors holds the lines with quoting errors
+	quoteErrors map[int]bool
+}
+
+// add records a problem
+func (d *diagnostics) add(lineNum, column int, msg string) {
+	d.list = append(d.list, Diagnostic{Line: lineNum, Column: column, Msg: msg})
+}
+
+// addValueError records a malformed value on line l, unless it comes from
+// a quoting error that was already reported
+func (d *diagnostics) addValueError(l line, err error) {
+	if !d.quoteErrors[l.num] {
+		d.add(l.num, l.indent+1, err.Error())
+	}
+}
+
+// quoteChecker reports unterminated quoted strings and invalid escape
+// sequences. A quote only opens a string where a quoted token can start, as
+// the decoder reads it: at the start of a key, list item or row, after ": ",
+// and after a delimiter between array values or cells. Elsewhere, as in
+// 5" long, it is part of a bare value.
+type quoteChecker struct {
+	d *diagnostics
+
+	// delimiter separates the cells of tabular rows, as declared by the
+	// last header with a field list
+	delimiter string
+
+	// lines is the number of non-blank lines in the document
+	lines int
+}
+
+// check checks the quoted tokens of one line
+func (c *quoteChecker) check(lineNum int, raw string) {
+	start := len(raw) - len(strings.TrimLeft(raw, Space))
+	text := raw[start:]
+	if c.lines == 1 {
+		if _, ok, err := parseFieldHeader(text); err == nil && !ok {
+			// A lone line that is not a key is a root primitive
+			c.token(lineNum, raw, start)
+			return
+		}
+	}
+	listItem := isListItem(text)
+	if listItem {
+		start += min(len(ListItemPrefix), len(text))
+		text = raw[start:]
+	}
+
+	// The first token is a key, a list item value or the first cell
+	if !c.token(lineNum, raw, start) {
+		return
+	}
+
+	var tokens []string
+	delimiter, cells := c.delimiter, false
+	offset := start
+	h, ok, err := parseFieldHeader(text)
+	switch {
+	case err != nil || listItem && !ok:
+		// A malformed header is reported by the parser, and a list item
+		// that is not a key holds a single value
+		return
+
+	case ok:
+		if h.fields != nil {
+			c.delimiter = h.delimiter
+		}
+		if h.rest == "" {
+			return
+		}
+		offset += len(strings.TrimRight(text, Space)) - len(h.rest)
+		tokens = []string{h.rest}
+		if h.isArray {
+			delimiter = h.delimiter
+			tokens = splitDelimited(h.rest, delimiter)
+		}
+
+	case delimiter != "":
+		cells = true
+		tokens = splitCells(text, delimiter)
+	}
+
+	for i, token := range tokens {
+		trimmed := strings.TrimLeft(token, Space)
+		pos := offset + len(token) - len(trimmed)
+		if i > 0 || pos != start {
+			if !c.token(lineNum, raw, pos) {
+				return
+			}
+		}
+		if cells && strings.HasPrefix(trimmed, OpenBracket) {
+			// Bracketed array cells hold delimited values of their own
+			inner := strings.TrimSuffix(trimmed[1:], CloseBracket)
+			itemOffset := pos + 1
+			for _, item := range splitDelimited(inner, delimiter) {
+				itemPos := itemOffset + len(item) - len(strings.TrimLeft(item, Space))
+				if !c.token(lineNum, raw, itemPos) {
+					return
+				}
+				itemOffset += len(item) + len(delimiter)
+			}
+		}
+		offset += len(token) + len(delimiter)
+	}
+}
+
+// token checks the token starting at raw[start], if it is quoted. It
+// reports false when the string is unterminated, which leaves the rest of
+// the line unreadable.
+func (c *quoteChecker) token(lineNum int, raw string, start int) bool {
+	if start >= len(raw) || raw[start] != '"' {
+		return true
+	}
+
+	i := start + 1
+	for ; i < len(raw) && raw[i] != '"'; i++ {
+		if raw[i] != '\\' {
+			continue
+		}
+		if i+1 < len(raw) && !isEscapeChar(raw[i+1]) {
+			c.d.add(lineNum, i+1, fmt.Sprintf("invalid escape sequence \\%c", raw[i+1]))
+			c.d.quoteErrors[lineNum] = true
+		}
+		i++
+	}
+	if i >= len(raw) {
+		c.d.add(lineNum, start+1, "unterminated string")
+		c.d.quoteErrors[lineNum] = true
+		return false
+	}
+	return true
+}
+
+// isEscapeChar checks if c may follow a backslash in a quoted string
+func isEscapeChar(c byte) bool {
+	switch c {
+	case '\\', '"', 'n', 'r', 't':
+		return true
+	}
+	return false
+}
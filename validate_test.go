@@ -0,0 +1,118 @@
+package gotoon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Diagnostic
+	}{
+		{
+			name:     "valid document",
+			input:    "name: Alice\nitems[2]{id,name}:\n  1,A\n  2,\"B, C\"\ntags[2]: a,b\nlist[1]:\n  - x\n",
+			expected: nil,
+		},
+		{
+			name:     "quotes inside bare values",
+			input:    "a: 5\" long\ntags[2]: a,5\"\nlist[1]:\n  - 1\" pipe\n",
+			expected: nil,
+		},
+		{
+			name:     "quoted empty key in list item",
+			input:    "[1]:\n  - \"\": 1\n",
+			expected: nil,
+		},
+		{
+			name:  "row count",
+			input: "items[3]{id,name}:\n  1,A\n  2,B\n",
+			expected: []Diagnostic{
+				{Line: 1, Column: 6, Msg: "array declares 3 rows, found 2"},
+			},
+		},
+		{
+			name:  "cell counts",
+			input: "items[2]{id,name}:\n  1,A,x\n  2\n",
+			expected: []Diagnostic{
+				{Line: 2, Column: 7, Msg: "row has 3 values, header declares 2 fields"},
+				{Line: 3, Column: 4, Msg: "row has 1 values, header declares 2 fields"},
+			},
+		},
+		{
+			name:  "inline and list lengths",
+			input: "tags[3]: a,b\nlist[1]:\n  - x\n  - y\n",
+			expected: []Diagnostic{
+				{Line: 1, Column: 5, Msg: "array declares 3 values, found 2"},
+				{Line: 2, Column: 5, Msg: "array declares 1 items, found 2"},
+			},
+		},
+		{
+			name:  "indentation",
+			input: "a:\n  b: 1\n\tc: 2\n   d: 3\nitems[2]{id}:\n    1\n      2\n",
+			expected: []Diagnostic{
+				{Line: 3, Column: 1, Msg: "tabs are not allowed in indentation"},
+				{Line: 4, Column: 4, Msg: "indentation of 3 spaces is not a multiple of 2"},
+				{Line: 7, Column: 7, Msg: "inconsistent row indentation"},
+			},
+		},
+		{
+			name:  "quoting",
+			input: "a: \"x\\qy\"\nb[2]: \"ok\",\"open\nc: 1\n",
+			expected: []Diagnostic{
+				{Line: 1, Column: 6, Msg: "invalid escape sequence \\q"},
+				{Line: 2, Column: 12, Msg: "unterminated string"},
+			},
+		},
+		{
+			name:  "structural error ends the check",
+			input: "items[3]: a,b\nfoo\nb[2]: x\n",
+			expected: []Diagnostic{
+				{Line: 1, Column: 6, Msg: "array declares 3 values, found 2"},
+				{Line: 2, Column: 1, Msg: "expected key"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := Validate([]byte(tt.input))
+			if !reflect.DeepEqual(diags, tt.expected) {
+				t.Errorf("expected:\n%v\n\ngot:\n%v", tt.expected, diags)
+			}
+		})
+	}
+}
+
+func TestValidateMatchesDecode(t *testing.T) {
+	// Every document Decode rejects must produce a diagnostic
+	inputs := []string{
+		"items[3]: a,b",
+		"items[1]{id,name}:\n  1",
+		"a:\n  b: 1\n\tc: 2",
+		"a: \"open",
+		"a: \"x\\qy\"",
+		"a: 1\nfoo",
+	}
+	for _, input := range inputs {
+		if _, err := Decode(input); err == nil {
+			t.Fatalf("expected Decode to reject %q", input)
+		}
+		if len(Validate([]byte(input))) == 0 {
+			t.Errorf("expected diagnostics for %q", input)
+		}
+	}
+
+	if diags := Validate([]byte("name: Alice\nitems[2]{id,name}:\n  1,A\n  2,B")); diags != nil {
+		t.Errorf("expected no diagnostics, got %v", diags)
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	d := Diagnostic{Line: 3, Column: 5, Msg: "unterminated string"}
+	if s := d.String(); s != "3:5: unterminated string" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
@@ -1,11 +1,19 @@
 package gotoon
 
-import "strings"
+import (
+	"bufio"
+	"io"
+	"strings"
+)
 
 // LineWriter manages indented line output for TOON format
 type LineWriter struct {
-	lines            []string
+	lines             []string
 	indentationString string
+
+	// out receives lines as they are pushed when the writer is streaming
+	out *bufio.Writer
+	err error
 }
 
 // NewLineWriter creates a new LineWriter with the specified indentation size
@@ -16,13 +24,54 @@ func NewLineWriter(indentSize int) *LineWriter {
 	}
 }
 
+// NewStreamingLineWriter creates a LineWriter that writes each line to w as
+// it is pushed, terminated by a newline, instead of accumulating the document
+// in memory. Output is buffered; call Flush when done.
+func NewStreamingLineWriter(w io.Writer, indentSize int) *LineWriter {
+	out, ok := w.(*bufio.Writer)
+	if !ok {
+		out = bufio.NewWriter(w)
+	}
+	return &LineWriter{
+		indentationString: strings.Repeat(" ", indentSize),
+		out:               out,
+	}
+}
+
 // Push adds a new line with the specified depth and content
 func (w *LineWriter) Push(depth int, content string) {
-	indent := strings.Repeat(w.indentationString, depth)
-	w.lines = append(w.lines, indent+content)
+	if w.out == nil {
+		indent := strings.Repeat(w.indentationString, depth)
+		w.lines = append(w.lines, indent+content)
+		return
+	}
+
+	// Stop writing after the first error; it is reported by Flush
+	if w.err != nil {
+		return
+	}
+	for i := 0; i < depth; i++ {
+		if _, w.err = w.out.WriteString(w.indentationString); w.err != nil {
+			return
+		}
+	}
+	if _, w.err = w.out.WriteString(content); w.err != nil {
+		return
+	}
+	w.err = w.out.WriteByte('\n')
+}
+
+// Flush writes any buffered output of a streaming LineWriter and returns the
+// first error encountered while writing
+func (w *LineWriter) Flush() error {
+	if w.out == nil || w.err != nil {
+		return w.err
+	}
+	return w.out.Flush()
 }
 
-// String returns the accumulated lines joined with newlines
+// String returns the accumulated lines joined with newlines. Streaming
+// writers do not accumulate lines and return an empty string.
 func (w *LineWriter) String() string {
 	return strings.Join(w.lines, "\n")
 }